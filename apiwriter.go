@@ -0,0 +1,537 @@
+package stackdriver
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultAPIEndpoint is the Cloud Logging entries.write endpoint.
+const DefaultAPIEndpoint = "https://logging.googleapis.com/v2/entries:write"
+
+// DefaultLogID is the log ID used for entries without a KeyLogID field.
+const DefaultLogID = "default"
+
+var (
+	// ErrBufferFull is returned by APIWriter.Write when buffering the entry
+	// would exceed the configured byte limit. The entry is dropped.
+	ErrBufferFull = errors.New("stackdriver: api writer buffer full")
+	// ErrWriterClosed is returned by APIWriter.Write after Close.
+	ErrWriterClosed = errors.New("stackdriver: api writer closed")
+	// ErrNoProject is returned by APIWriter.Write when the writer was
+	// created without a project. The entries are dropped.
+	ErrNoProject = errors.New("stackdriver: api writer has no project")
+)
+
+// APIWriter is an io.Writer sending entries produced by the Formatter to the
+// Cloud Logging entries.write API. Entries are batched in the background;
+// call Flush or Close before the process exits.
+type APIWriter struct {
+	projectID         string
+	logID             string
+	endpoint          string
+	tokenSource       TokenSource
+	client            *http.Client
+	resource          *Resource
+	labels            map[string]string
+	batchCount        int
+	batchBytes        int
+	delayThreshold    time.Duration
+	bufferedByteLimit int
+	maxRetries        int
+	initialBackoff    time.Duration
+	maxBackoff        time.Duration
+	onError           func(error)
+	metrics           *Metrics
+
+	mu       sync.Mutex
+	pending  []json.RawMessage
+	pendSize int // bytes held in pending
+	size     int // bytes held in pending and in-flight batches
+	closed   bool
+	dropped  int64
+	kick     chan struct{}
+	flushes  chan chan struct{}
+	quit     chan struct{}
+	finished chan struct{}
+}
+
+// APIWriterOption lets you configure the APIWriter.
+type APIWriterOption func(*APIWriter)
+
+// WithAPIEndpoint overrides the entries.write URL, e.g. to target a local stand-in.
+func WithAPIEndpoint(u string) APIWriterOption {
+	return func(w *APIWriter) {
+		w.endpoint = u
+	}
+}
+
+// WithAPITokenSource sets the source of access tokens. By default tokens are
+// fetched from the metadata server.
+func WithAPITokenSource(ts TokenSource) APIWriterOption {
+	return func(w *APIWriter) {
+		w.tokenSource = ts
+	}
+}
+
+// WithAPIHTTPClient sets the HTTP client used to send requests.
+func WithAPIHTTPClient(c *http.Client) APIWriterOption {
+	return func(w *APIWriter) {
+		w.client = c
+	}
+}
+
+// WithAPILogID sets the log ID used for entries without a KeyLogID field.
+func WithAPILogID(id string) APIWriterOption {
+	return func(w *APIWriter) {
+		w.logID = id
+	}
+}
+
+// WithAPIResource sets the monitored resource entries are written against.
+func WithAPIResource(r *Resource) APIWriterOption {
+	return func(w *APIWriter) {
+		w.resource = r
+	}
+}
+
+// WithAPILabels sets labels added to every entry.
+func WithAPILabels(labels map[string]string) APIWriterOption {
+	return func(w *APIWriter) {
+		w.labels = labels
+	}
+}
+
+// WithAPIBatching lets you configure when a batch is sent: once it holds
+// count entries or bytes bytes, and otherwise every delay.
+//
+// Counts and sizes below one are raised to one, and delays which aren't
+// positive default to a second.
+func WithAPIBatching(count, bytes int, delay time.Duration) APIWriterOption {
+	return func(w *APIWriter) {
+		w.batchCount = count
+		w.batchBytes = bytes
+		w.delayThreshold = delay
+	}
+}
+
+// WithAPIBufferLimit bounds the bytes held in memory. Writes beyond the limit
+// are dropped and return ErrBufferFull.
+func WithAPIBufferLimit(bytes int) APIWriterOption {
+	return func(w *APIWriter) {
+		w.bufferedByteLimit = bytes
+	}
+}
+
+// WithAPIRetries lets you configure how often a failed batch is retried and
+// the exponential backoff between attempts.
+func WithAPIRetries(max int, initial, maxBackoff time.Duration) APIWriterOption {
+	return func(w *APIWriter) {
+		w.maxRetries = max
+		w.initialBackoff = initial
+		w.maxBackoff = maxBackoff
+	}
+}
+
+// WithAPIErrorHandler sets the function called when a batch can't be
+// delivered. By default errors are printed to stderr.
+func WithAPIErrorHandler(fn func(error)) APIWriterOption {
+	return func(w *APIWriter) {
+		w.onError = fn
+	}
+}
+
+// WithAPIMetrics lets you configure Metrics counting the dropped entries.
+func WithAPIMetrics(m *Metrics) APIWriterOption {
+	return func(w *APIWriter) {
+		w.metrics = m
+	}
+}
+
+// NewAPIWriter returns a new APIWriter writing to the logs of projectID,
+// which can't be empty: log names and traces are qualified with it.
+func NewAPIWriter(projectID string, options ...APIWriterOption) *APIWriter {
+	w := &APIWriter{
+		projectID:         projectID,
+		logID:             DefaultLogID,
+		endpoint:          DefaultAPIEndpoint,
+		client:            &http.Client{Timeout: 30 * time.Second},
+		resource:          &Resource{Type: "global"},
+		batchCount:        1000,
+		batchBytes:        5 << 20,
+		delayThreshold:    time.Second,
+		bufferedByteLimit: 50 << 20,
+		maxRetries:        5,
+		initialBackoff:    100 * time.Millisecond,
+		maxBackoff:        10 * time.Second,
+		onError: func(err error) {
+			fmt.Fprintf(os.Stderr, "stackdriver: %v\n", err)
+		},
+		kick:     make(chan struct{}, 1),
+		flushes:  make(chan chan struct{}),
+		quit:     make(chan struct{}),
+		finished: make(chan struct{}),
+	}
+	for _, option := range options {
+		option(w)
+	}
+	// Batches hold at least one entry, and the ticker needs a positive delay.
+	if w.batchCount < 1 {
+		w.batchCount = 1
+	}
+	if w.batchBytes < 1 {
+		w.batchBytes = 1
+	}
+	if w.delayThreshold <= 0 {
+		w.delayThreshold = time.Second
+	}
+	if w.tokenSource == nil {
+		w.tokenSource = MetadataTokenSource("")
+	}
+
+	go w.run()
+
+	return w
+}
+
+// Write converts the formatted entries in p, one JSON object per line, and
+// queues them for delivery.
+func (w *APIWriter) Write(p []byte) (int, error) {
+	var entries []json.RawMessage
+	scanner := bufio.NewScanner(bytes.NewReader(p))
+	scanner.Buffer(nil, len(p)+1)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		entry, err := w.convert(line)
+		if err != nil {
+			return 0, err
+		}
+		entries = append(entries, entry)
+	}
+	if w.projectID == "" {
+		w.drop(int64(len(entries)))
+		return 0, ErrNoProject
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return 0, ErrWriterClosed
+	}
+
+	var n int
+	for _, entry := range entries {
+		n += len(entry)
+	}
+	if w.size+n > w.bufferedByteLimit {
+		w.drop(int64(len(entries)))
+		return 0, ErrBufferFull
+	}
+
+	w.pending = append(w.pending, entries...)
+	w.pendSize += n
+	w.size += n
+
+	if len(w.pending) >= w.batchCount || w.pendSize >= w.batchBytes {
+		select {
+		case w.kick <- struct{}{}:
+		default:
+		}
+	}
+
+	return len(p), nil
+}
+
+// drop counts n dropped entries.
+func (w *APIWriter) drop(n int64) {
+	atomic.AddInt64(&w.dropped, n)
+	w.metrics.droppedOut(n)
+}
+
+// Dropped returns the number of entries dropped because the buffer was full
+// or because they couldn't be delivered.
+func (w *APIWriter) Dropped() int64 {
+	return atomic.LoadInt64(&w.dropped)
+}
+
+// Flush sends all buffered entries and waits until they are delivered or
+// given up on.
+func (w *APIWriter) Flush() {
+	done := make(chan struct{})
+	select {
+	case w.flushes <- done:
+		<-done
+	case <-w.finished:
+	}
+}
+
+// Close flushes the buffered entries and stops the background sender.
+func (w *APIWriter) Close() error {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return nil
+	}
+	w.closed = true
+	w.mu.Unlock()
+
+	w.Flush()
+	close(w.quit)
+	<-w.finished
+	return nil
+}
+
+func (w *APIWriter) run() {
+	defer close(w.finished)
+
+	ticker := time.NewTicker(w.delayThreshold)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			w.sendPending()
+		case <-w.kick:
+			w.sendPending()
+		case done := <-w.flushes:
+			w.sendPending()
+			close(done)
+		case <-w.quit:
+			w.sendPending()
+			return
+		}
+	}
+}
+
+// sendPending delivers everything buffered so far in batches.
+func (w *APIWriter) sendPending() {
+	for {
+		batch, n := w.nextBatch()
+		if len(batch) == 0 {
+			return
+		}
+		if err := w.send(batch); err != nil {
+			w.drop(int64(len(batch)))
+			w.onError(err)
+		}
+		w.mu.Lock()
+		w.size -= n
+		w.mu.Unlock()
+	}
+}
+
+// nextBatch removes up to batchCount entries, or batchBytes bytes, from pending.
+func (w *APIWriter) nextBatch() ([]json.RawMessage, int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	var i, n int
+	for i < len(w.pending) && i < w.batchCount {
+		if i > 0 && n+len(w.pending[i]) > w.batchBytes {
+			break
+		}
+		n += len(w.pending[i])
+		i++
+	}
+
+	batch := w.pending[:i:i]
+	w.pending = w.pending[i:]
+	w.pendSize -= n
+	if len(w.pending) == 0 {
+		w.pending = nil
+	}
+	return batch, n
+}
+
+type apiWriteRequest struct {
+	Resource       *Resource         `json:"resource,omitempty"`
+	Labels         map[string]string `json:"labels,omitempty"`
+	Entries        []json.RawMessage `json:"entries"`
+	PartialSuccess bool              `json:"partialSuccess"`
+}
+
+// apiError is a failed entries.write call.
+type apiError struct {
+	status int
+	body   string
+}
+
+func (e *apiError) Error() string {
+	return fmt.Sprintf("entries.write: %d %s: %s", e.status, http.StatusText(e.status), e.body)
+}
+
+func (e *apiError) retryable() bool {
+	switch e.status {
+	case http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// send delivers one batch, retrying transient failures with exponential backoff.
+func (w *APIWriter) send(batch []json.RawMessage) error {
+	body, err := json.Marshal(apiWriteRequest{
+		Resource:       w.resource,
+		Labels:         w.labels,
+		Entries:        batch,
+		PartialSuccess: true,
+	})
+	if err != nil {
+		return err
+	}
+
+	backoff := w.initialBackoff
+	for attempt := 0; ; attempt++ {
+		err = w.post(body)
+		if err == nil {
+			return nil
+		}
+		var aerr *apiError
+		if errors.As(err, &aerr) && !aerr.retryable() {
+			return err
+		}
+		if attempt >= w.maxRetries {
+			return fmt.Errorf("giving up after %d attempts: %w", attempt+1, err)
+		}
+		time.Sleep(backoff)
+		if backoff *= 2; backoff > w.maxBackoff {
+			backoff = w.maxBackoff
+		}
+	}
+}
+
+func (w *APIWriter) post(body []byte) error {
+	token, err := w.tokenSource.Token()
+	if err != nil {
+		return fmt.Errorf("fetching token: %w", err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, w.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	res, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	b, _ := ioutil.ReadAll(io.LimitReader(res.Body, 4<<10))
+	if res.StatusCode != http.StatusOK {
+		return &apiError{status: res.StatusCode, body: strings.TrimSpace(string(b))}
+	}
+	return nil
+}
+
+// Keys of the Formatter output which map onto LogEntry fields rather than
+// the jsonPayload.
+const (
+	jsonKeyLogName        = "logName"
+	jsonKeyResource       = "resource"
+	jsonKeyTimestamp      = "timestamp"
+	jsonKeySeverity       = "severity"
+	jsonKeyHTTPRequest    = "httpRequest"
+	jsonKeyTrace          = "logging.googleapis.com/trace"
+	jsonKeySpanID         = "logging.googleapis.com/spanId"
+	jsonKeySourceLocation = "sourceLocation"
+	jsonKeyLabels         = "logging.googleapis.com/labels"
+	jsonKeyTraceSampled   = "logging.googleapis.com/trace_sampled"
+)
+
+// convert turns one line of Formatter output into a LogEntry in the JSON
+// representation expected by entries.write. Lines that aren't JSON objects
+// are sent as textPayload.
+func (w *APIWriter) convert(line []byte) (json.RawMessage, error) {
+	var payload map[string]interface{}
+	dec := json.NewDecoder(bytes.NewReader(line))
+	dec.UseNumber()
+	if err := dec.Decode(&payload); err != nil {
+		return json.Marshal(map[string]interface{}{
+			"logName":     w.logName(""),
+			"textPayload": string(line),
+		})
+	}
+
+	logName, _ := payload[jsonKeyLogName].(string)
+	entry := logEntryJSON(payload)
+	entry["logName"] = w.logName(logName)
+	// entries.write only links traces given as full resource names, which
+	// the Formatter writes only when it knows the project.
+	if trace, ok := entry["trace"].(string); ok && !strings.HasPrefix(trace, "projects/") {
+		entry["trace"] = "projects/" + w.projectID + "/traces/" + trace
+	}
+
+	return json.Marshal(entry)
+}
+
+// logEntryJSON moves the keys of the Formatter output which map onto
+// LogEntry fields out of payload, and returns the LogEntry in its JSON
+// representation with the rest of payload as jsonPayload.
+func logEntryJSON(payload map[string]interface{}) map[string]interface{} {
+	entry := map[string]interface{}{}
+
+	for key, field := range map[string]string{
+		jsonKeyLogName:      "logName",
+		jsonKeyResource:     "resource",
+		jsonKeyTimestamp:    "timestamp",
+		jsonKeySeverity:     "severity",
+		jsonKeyHTTPRequest:  "httpRequest",
+		jsonKeyTrace:        "trace",
+		jsonKeySpanID:       "spanId",
+		jsonKeyLabels:       "labels",
+		jsonKeyTraceSampled: "traceSampled",
+	} {
+		if val, ok := payload[key]; ok {
+			entry[field] = val
+			delete(payload, key)
+		}
+	}
+
+	if loc, ok := payload[jsonKeySourceLocation].(map[string]interface{}); ok {
+		source := map[string]interface{}{}
+		if v, ok := loc["filePath"]; ok {
+			source["file"] = v
+		}
+		if v, ok := loc["lineNumber"]; ok {
+			source["line"] = v
+		}
+		if v, ok := loc["functionName"]; ok {
+			source["function"] = v
+		}
+		entry["sourceLocation"] = source
+		delete(payload, jsonKeySourceLocation)
+	}
+
+	entry["jsonPayload"] = payload
+
+	return entry
+}
+
+// logName returns the fully qualified log name for a KeyLogID value.
+func (w *APIWriter) logName(id string) string {
+	if id == "" {
+		id = w.logID
+	}
+	if strings.Contains(id, "/logs/") {
+		return id
+	}
+	return "projects/" + w.projectID + "/logs/" + escapeLogID(id)
+}
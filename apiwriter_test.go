@@ -0,0 +1,194 @@
+package stackdriver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeLoggingAPI struct {
+	mu       sync.Mutex
+	requests []map[string]interface{}
+	failures int
+	auth     []string
+}
+
+func (a *fakeLoggingAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.auth = append(a.auth, r.Header.Get("Authorization"))
+	if a.failures > 0 {
+		a.failures--
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+
+	var req map[string]interface{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	a.requests = append(a.requests, req)
+	w.Write([]byte("{}"))
+}
+
+func (a *fakeLoggingAPI) entries() []map[string]interface{} {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	var entries []map[string]interface{}
+	for _, req := range a.requests {
+		for _, e := range req["entries"].([]interface{}) {
+			entries = append(entries, e.(map[string]interface{}))
+		}
+	}
+	return entries
+}
+
+func newTestAPIWriter(t *testing.T, api *fakeLoggingAPI, options ...APIWriterOption) *APIWriter {
+	srv := httptest.NewServer(api)
+	t.Cleanup(srv.Close)
+
+	options = append([]APIWriterOption{
+		WithAPIEndpoint(srv.URL),
+		WithAPITokenSource(TokenSourceFunc(func() (string, error) { return "test-token", nil })),
+		WithAPIRetries(3, time.Millisecond, time.Millisecond),
+	}, options...)
+	return NewAPIWriter("my-project", options...)
+}
+
+func TestAPIWriter(t *testing.T) {
+	api := &fakeLoggingAPI{}
+	w := newTestAPIWriter(t, api,
+		WithAPIResource(&Resource{Type: "gce_instance", Labels: map[string]string{"instance_id": "1"}}),
+		WithAPILabels(map[string]string{"env": "test"}),
+	)
+
+	logger := logrus.New()
+	logger.Out = w
+	logger.Formatter = NewFormatter(
+		WithService("test"),
+		WithVersion("0.1"),
+	)
+
+	logger.WithField("foo", "bar").WithField(KeyTrace, "105445aa7843bc8bf206b12000100000").Info("my log entry")
+	logger.WithField(KeyLogID, "requests").Error("my error")
+	w.Flush()
+
+	require.Len(t, api.requests, 1)
+	req := api.requests[0]
+	require.Equal(t, map[string]interface{}{"type": "gce_instance", "labels": map[string]interface{}{"instance_id": "1"}}, req["resource"])
+	require.Equal(t, map[string]interface{}{"env": "test"}, req["labels"])
+	require.Equal(t, "Bearer test-token", api.auth[0])
+
+	entries := api.entries()
+	require.Len(t, entries, 2)
+
+	require.Equal(t, "projects/my-project/logs/default", entries[0]["logName"])
+	require.Equal(t, "INFO", entries[0]["severity"])
+	require.Equal(t, "projects/my-project/traces/105445aa7843bc8bf206b12000100000", entries[0]["trace"])
+	require.Equal(t, map[string]interface{}{
+		"message": "my log entry",
+		"context": map[string]interface{}{
+			"data": map[string]interface{}{"foo": "bar"},
+		},
+		"serviceContext": map[string]interface{}{"service": "test", "version": "0.1"},
+	}, entries[0]["jsonPayload"])
+
+	require.Equal(t, "projects/my-project/logs/requests", entries[1]["logName"])
+	require.Equal(t, "ERROR", entries[1]["severity"])
+	require.Contains(t, entries[1], "sourceLocation")
+	require.Contains(t, entries[1]["sourceLocation"], "file")
+	require.Contains(t, entries[1]["sourceLocation"], "line")
+}
+
+func TestAPIWriterBatchCount(t *testing.T) {
+	api := &fakeLoggingAPI{}
+	w := newTestAPIWriter(t, api, WithAPIBatching(2, 1<<20, time.Hour))
+
+	for i := 0; i < 5; i++ {
+		w.Write([]byte(`{"message":"entry"}` + "\n"))
+	}
+	w.Flush()
+
+	require.Len(t, api.entries(), 5)
+	require.Len(t, api.requests, 3)
+}
+
+func TestAPIWriterInvalidBatching(t *testing.T) {
+	api := &fakeLoggingAPI{}
+	w := newTestAPIWriter(t, api, WithAPIBatching(0, 0, 0))
+
+	for i := 0; i < 3; i++ {
+		w.Write([]byte(`{"message":"entry"}` + "\n"))
+	}
+	require.NoError(t, w.Close())
+
+	require.Len(t, api.entries(), 3)
+	require.Len(t, api.requests, 3)
+}
+
+func TestAPIWriterNoProject(t *testing.T) {
+	w := NewAPIWriter("", WithAPITokenSource(TokenSourceFunc(func() (string, error) { return "test-token", nil })))
+	defer w.Close()
+
+	_, err := w.Write([]byte(`{"message":"entry"}` + "\n"))
+	require.Equal(t, ErrNoProject, err)
+	require.EqualValues(t, 1, w.Dropped())
+}
+
+func TestAPIWriterRetry(t *testing.T) {
+	api := &fakeLoggingAPI{failures: 2}
+	w := newTestAPIWriter(t, api)
+
+	w.Write([]byte(`{"message":"entry"}`))
+	w.Flush()
+
+	require.Len(t, api.entries(), 1)
+	require.Len(t, api.auth, 3)
+	require.Zero(t, w.Dropped())
+}
+
+func TestAPIWriterGiveUp(t *testing.T) {
+	api := &fakeLoggingAPI{failures: 10}
+	var errs []error
+	w := newTestAPIWriter(t, api, WithAPIErrorHandler(func(err error) { errs = append(errs, err) }))
+
+	w.Write([]byte(`{"message":"entry"}`))
+	w.Flush()
+
+	require.Empty(t, api.entries())
+	require.Len(t, errs, 1)
+	require.EqualValues(t, 1, w.Dropped())
+}
+
+func TestAPIWriterBufferLimit(t *testing.T) {
+	api := &fakeLoggingAPI{}
+	w := newTestAPIWriter(t, api, WithAPIBufferLimit(10), WithAPIBatching(1000, 1<<20, time.Hour))
+
+	_, err := w.Write([]byte(`{"message":"a long enough entry"}`))
+	require.Equal(t, ErrBufferFull, err)
+	require.EqualValues(t, 1, w.Dropped())
+}
+
+func TestAPIWriterClose(t *testing.T) {
+	api := &fakeLoggingAPI{}
+	w := newTestAPIWriter(t, api, WithAPIBatching(1000, 1<<20, time.Hour))
+
+	w.Write([]byte("not json\n"))
+	require.NoError(t, w.Close())
+
+	entries := api.entries()
+	require.Len(t, entries, 1)
+	require.Equal(t, "not json", entries[0]["textPayload"])
+
+	_, err := w.Write([]byte(`{"message":"entry"}`))
+	require.Equal(t, ErrWriterClosed, err)
+}
@@ -0,0 +1,348 @@
+package stackdriver
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// ErrAsyncWriterClosed is returned by AsyncWriter.Write after Close.
+var ErrAsyncWriterClosed = errors.New("stackdriver: async writer closed")
+
+// OverflowPolicy decides what an AsyncWriter does when its queue is full.
+type OverflowPolicy int
+
+const (
+	// OverflowBlock makes Write wait until there is room in the queue.
+	OverflowBlock OverflowPolicy = iota
+	// OverflowDropOldest discards the oldest queued entry.
+	OverflowDropOldest
+	// OverflowDropBySeverity discards the oldest of the least severe entries,
+	// so DEBUG entries go before ERROR entries.
+	OverflowDropBySeverity
+)
+
+type asyncEntry struct {
+	line     []byte
+	severity severity
+}
+
+// AsyncWriter is an io.Writer queueing entries produced by the Formatter
+// and writing them to an underlying writer in the background, so logging
+// doesn't stall when the output backs up.
+//
+// Entries with CRITICAL or ALERT severity, i.e. logged with Fatal or Panic,
+// are written before Write returns. Until it is closed, the writer is also
+// flushed by the logrus exit handlers run before Fatal exits.
+type AsyncWriter struct {
+	out             io.Writer
+	size            int
+	policy          OverflowPolicy
+	summaryInterval time.Duration
+	metrics         *Metrics
+
+	mu      sync.Mutex
+	cond    *sync.Cond
+	queue   []asyncEntry
+	writing bool
+	closed  bool
+	dropped map[severity]int64
+	total   int64
+	quit    chan struct{}
+	done    chan struct{}
+}
+
+// AsyncWriterOption lets you configure the AsyncWriter.
+type AsyncWriterOption func(*AsyncWriter)
+
+// WithAsyncQueueSize sets how many entries can be queued, at least one.
+func WithAsyncQueueSize(n int) AsyncWriterOption {
+	return func(w *AsyncWriter) {
+		w.size = n
+	}
+}
+
+// WithAsyncOverflow sets what happens when the queue is full.
+func WithAsyncOverflow(p OverflowPolicy) AsyncWriterOption {
+	return func(w *AsyncWriter) {
+		w.policy = p
+	}
+}
+
+// WithAsyncSummaryInterval sets how often an entry summarising the dropped
+// entries is written. Zero disables periodic summaries; drops are still
+// summarised on Flush.
+func WithAsyncSummaryInterval(d time.Duration) AsyncWriterOption {
+	return func(w *AsyncWriter) {
+		w.summaryInterval = d
+	}
+}
+
+// WithAsyncMetrics lets you configure Metrics counting the dropped entries.
+func WithAsyncMetrics(m *Metrics) AsyncWriterOption {
+	return func(w *AsyncWriter) {
+		w.metrics = m
+	}
+}
+
+// NewAsyncWriter returns a new AsyncWriter writing to out.
+func NewAsyncWriter(out io.Writer, options ...AsyncWriterOption) *AsyncWriter {
+	w := &AsyncWriter{
+		out:             out,
+		size:            10000,
+		policy:          OverflowBlock,
+		summaryInterval: time.Minute,
+		dropped:         map[severity]int64{},
+		quit:            make(chan struct{}),
+		done:            make(chan struct{}),
+	}
+	for _, option := range options {
+		option(w)
+	}
+	// The overflow policies need room for at least one entry.
+	if w.size < 1 {
+		w.size = 1
+	}
+	w.cond = sync.NewCond(&w.mu)
+
+	flushAtExit(w)
+
+	go w.run()
+	if w.summaryInterval > 0 {
+		go w.summarize()
+	}
+
+	return w
+}
+
+// Write queues the entries in p, one per line.
+func (w *AsyncWriter) Write(p []byte) (int, error) {
+	// Format writes nothing for entries dropped by a Sampler.
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	// Format writes several entries at once, e.g. the buffered entries of a
+	// trace or a summary, so each line is queued with its own severity.
+	var entries []asyncEntry
+	var flush bool
+	for rest := p; len(rest) > 0; {
+		line := rest
+		if i := bytes.IndexByte(rest, '\n'); i >= 0 {
+			line = rest[:i+1]
+		}
+		rest = rest[len(line):]
+
+		var meta struct {
+			Severity severity `json:"severity"`
+		}
+		json.Unmarshal(line, &meta)
+
+		entries = append(entries, asyncEntry{
+			// The caller may reuse p once we return.
+			line:     append([]byte(nil), line...),
+			severity: meta.Severity,
+		})
+		switch meta.Severity {
+		case severityCritical, severityAlert:
+			flush = true
+		}
+	}
+
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return 0, ErrAsyncWriterClosed
+	}
+	for _, entry := range entries {
+		w.enqueue(entry)
+	}
+	w.mu.Unlock()
+
+	if flush {
+		w.Flush()
+	}
+
+	return len(p), nil
+}
+
+// enqueue must be called with w.mu held.
+func (w *AsyncWriter) enqueue(entry asyncEntry) {
+	for len(w.queue) >= w.size {
+		switch w.policy {
+		case OverflowDropOldest:
+			w.drop(0)
+		case OverflowDropBySeverity:
+			i := w.leastSevere()
+			if severityRank[entry.severity] <= severityRank[w.queue[i].severity] {
+				w.dropped[entry.severity]++
+				w.total++
+				w.metrics.droppedOut(1)
+				return
+			}
+			w.drop(i)
+		default:
+			w.cond.Wait()
+			if w.closed {
+				return
+			}
+		}
+	}
+
+	w.queue = append(w.queue, entry)
+	w.cond.Broadcast()
+}
+
+// leastSevere returns the index of the oldest of the least severe queued entries.
+func (w *AsyncWriter) leastSevere() int {
+	var min int
+	for i := range w.queue {
+		if severityRank[w.queue[i].severity] < severityRank[w.queue[min].severity] {
+			min = i
+		}
+	}
+	return min
+}
+
+func (w *AsyncWriter) drop(i int) {
+	w.dropped[w.queue[i].severity]++
+	w.total++
+	w.metrics.droppedOut(1)
+	w.queue = append(w.queue[:i], w.queue[i+1:]...)
+}
+
+// Dropped returns the number of entries dropped because the queue was full.
+func (w *AsyncWriter) Dropped() int64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.total
+}
+
+// Flush writes a summary of dropped entries and waits until the queue is empty.
+func (w *AsyncWriter) Flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.queueSummary()
+	for (len(w.queue) > 0 || w.writing) && !w.stopped() {
+		w.cond.Wait()
+	}
+}
+
+// Close flushes the queue and stops the background writer.
+func (w *AsyncWriter) Close() error {
+	forgetAtExit(w)
+	w.Flush()
+
+	w.mu.Lock()
+	if !w.closed {
+		w.closed = true
+		close(w.quit)
+		w.cond.Broadcast()
+	}
+	w.mu.Unlock()
+
+	<-w.done
+	return nil
+}
+
+// stopped reports whether the background writer has exited.
+func (w *AsyncWriter) stopped() bool {
+	select {
+	case <-w.done:
+		return true
+	default:
+		return false
+	}
+}
+
+func (w *AsyncWriter) run() {
+	defer func() {
+		w.mu.Lock()
+		close(w.done)
+		w.cond.Broadcast()
+		w.mu.Unlock()
+	}()
+
+	for {
+		w.mu.Lock()
+		for len(w.queue) == 0 && !w.closed {
+			w.cond.Wait()
+		}
+		if len(w.queue) == 0 {
+			w.mu.Unlock()
+			return
+		}
+		batch := w.queue
+		w.queue = nil
+		w.writing = true
+		w.cond.Broadcast()
+		w.mu.Unlock()
+
+		for _, entry := range batch {
+			w.out.Write(entry.line)
+		}
+
+		w.mu.Lock()
+		w.writing = false
+		w.cond.Broadcast()
+		w.mu.Unlock()
+	}
+}
+
+func (w *AsyncWriter) summarize() {
+	ticker := time.NewTicker(w.summaryInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			w.mu.Lock()
+			w.queueSummary()
+			w.mu.Unlock()
+		case <-w.quit:
+			return
+		}
+	}
+}
+
+// queueSummary queues an entry reporting the drops since the last summary.
+// It must be called with w.mu held.
+func (w *AsyncWriter) queueSummary() {
+	if len(w.dropped) == 0 || w.closed {
+		return
+	}
+
+	counts := make(map[string]interface{}, len(w.dropped))
+	var n int64
+	for s, c := range w.dropped {
+		counts[string(s)] = c
+		n += c
+	}
+	w.dropped = map[severity]int64{}
+
+	ee := Entry{
+		Message:  fmt.Sprintf("dropped %d log entries", n),
+		Severity: severityWarning,
+		Context: &Context{
+			Data: map[string]interface{}{
+				"droppedEntries": counts,
+			},
+		},
+	}
+	if !skipTimestamp {
+		ee.Timestamp = time.Now().UTC().Format(time.RFC3339Nano)
+	}
+	b, err := json.Marshal(ee)
+	if err != nil {
+		return
+	}
+
+	// Summaries bypass the overflow policy, they are what reports it.
+	w.queue = append(w.queue, asyncEntry{line: append(b, '\n'), severity: severityWarning})
+	w.cond.Broadcast()
+}
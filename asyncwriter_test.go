@@ -0,0 +1,216 @@
+package stackdriver
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+// gatedWriter blocks writes until opened.
+type gatedWriter struct {
+	gate chan struct{}
+
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func newGatedWriter() *gatedWriter {
+	return &gatedWriter{gate: make(chan struct{})}
+}
+
+func (g *gatedWriter) Write(p []byte) (int, error) {
+	<-g.gate
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.buf.Write(p)
+}
+
+func (g *gatedWriter) lines() []string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return strings.Split(strings.TrimSpace(g.buf.String()), "\n")
+}
+
+func messages(t *testing.T, lines []string) []string {
+	var msgs []string
+	for _, line := range lines {
+		var e map[string]interface{}
+		require.NoError(t, json.Unmarshal([]byte(line), &e))
+		msgs = append(msgs, e["message"].(string))
+	}
+	return msgs
+}
+
+// fillQueue writes a first entry, waits until the background writer is stuck
+// writing it, then queues the rest.
+func fillQueue(w *AsyncWriter, entries ...string) {
+	w.Write([]byte(entries[0]))
+	for {
+		w.mu.Lock()
+		writing := w.writing
+		w.mu.Unlock()
+		if writing {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	for _, e := range entries[1:] {
+		w.Write([]byte(e))
+	}
+}
+
+func TestAsyncWriterDropOldest(t *testing.T) {
+	out := newGatedWriter()
+	w := NewAsyncWriter(out, WithAsyncQueueSize(2), WithAsyncOverflow(OverflowDropOldest), WithAsyncSummaryInterval(0))
+
+	fillQueue(w,
+		`{"message":"0","severity":"INFO"}`+"\n",
+		`{"message":"1","severity":"INFO"}`+"\n",
+		`{"message":"2","severity":"INFO"}`+"\n",
+		`{"message":"3","severity":"INFO"}`+"\n",
+	)
+	close(out.gate)
+	w.Close()
+
+	require.EqualValues(t, 1, w.Dropped())
+	require.Equal(t, []string{"0", "2", "3", "dropped 1 log entries"}, messages(t, out.lines()))
+}
+
+func TestAsyncWriterDropBySeverity(t *testing.T) {
+	out := newGatedWriter()
+	w := NewAsyncWriter(out, WithAsyncQueueSize(2), WithAsyncOverflow(OverflowDropBySeverity), WithAsyncSummaryInterval(0))
+
+	fillQueue(w,
+		`{"message":"0","severity":"INFO"}`+"\n",
+		`{"message":"1","severity":"ERROR"}`+"\n",
+		`{"message":"2","severity":"DEBUG"}`+"\n",
+		`{"message":"3","severity":"WARNING"}`+"\n",
+		`{"message":"4","severity":"DEBUG"}`+"\n",
+	)
+	close(out.gate)
+	w.Close()
+
+	lines := out.lines()
+	require.Equal(t, []string{"0", "1", "3", "dropped 2 log entries"}, messages(t, lines))
+
+	var summary map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(lines[3]), &summary))
+	require.Equal(t, "WARNING", summary["severity"])
+	require.Equal(t, map[string]interface{}{
+		"data": map[string]interface{}{
+			"droppedEntries": map[string]interface{}{"DEBUG": 2.0},
+		},
+	}, summary["context"])
+}
+
+func TestAsyncWriterBlock(t *testing.T) {
+	out := newGatedWriter()
+	w := NewAsyncWriter(out, WithAsyncQueueSize(1), WithAsyncSummaryInterval(0))
+
+	fillQueue(w, `{"message":"0"}`+"\n", `{"message":"1"}`+"\n")
+
+	written := make(chan struct{})
+	go func() {
+		w.Write([]byte(`{"message":"2"}` + "\n"))
+		close(written)
+	}()
+
+	select {
+	case <-written:
+		t.Fatal("write didn't block on a full queue")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	close(out.gate)
+	<-written
+	w.Close()
+
+	require.Zero(t, w.Dropped())
+	require.Equal(t, []string{"0", "1", "2"}, messages(t, out.lines()))
+}
+
+func TestAsyncWriterFatal(t *testing.T) {
+	out := newGatedWriter()
+	close(out.gate)
+	w := NewAsyncWriter(out, WithAsyncSummaryInterval(0))
+	defer w.Close()
+
+	logger := logrus.New()
+	logger.Out = w
+	logger.Formatter = NewFormatter()
+
+	var exited bool
+	logger.ExitFunc = func(int) {
+		exited = true
+		require.Equal(t, []string{"my log entry", "fatal entry"}, messages(t, out.lines()))
+	}
+
+	logger.Info("my log entry")
+	logger.Fatal("fatal entry")
+	require.True(t, exited)
+}
+
+func TestAsyncWriterMultipleLines(t *testing.T) {
+	out := newGatedWriter()
+	w := NewAsyncWriter(out, WithAsyncQueueSize(2), WithAsyncOverflow(OverflowDropBySeverity), WithAsyncSummaryInterval(0))
+
+	fillQueue(w,
+		`{"message":"0","severity":"INFO"}`+"\n",
+		`{"message":"1","severity":"DEBUG"}`+"\n"+
+			`{"message":"2","severity":"DEBUG"}`+"\n"+
+			`{"message":"3","severity":"ERROR"}`+"\n",
+	)
+	close(out.gate)
+	w.Close()
+
+	require.Equal(t, []string{"0", "2", "3", "dropped 1 log entries"}, messages(t, out.lines()))
+}
+
+func TestAsyncWriterMultipleLinesFatal(t *testing.T) {
+	out := newGatedWriter()
+	close(out.gate)
+	w := NewAsyncWriter(out, WithAsyncSummaryInterval(0))
+	defer w.Close()
+
+	w.Write([]byte(`{"message":"0","severity":"DEBUG"}` + "\n" + `{"message":"1","severity":"CRITICAL"}` + "\n"))
+
+	// Written before Write returns.
+	require.Equal(t, []string{"0", "1"}, messages(t, out.lines()))
+}
+
+func TestAsyncWriterQueueSize(t *testing.T) {
+	for _, policy := range []OverflowPolicy{OverflowBlock, OverflowDropOldest, OverflowDropBySeverity} {
+		out := newGatedWriter()
+		close(out.gate)
+		w := NewAsyncWriter(out, WithAsyncQueueSize(0), WithAsyncOverflow(policy), WithAsyncSummaryInterval(0))
+
+		w.Write([]byte(`{"message":"0","severity":"INFO"}` + "\n"))
+		w.Close()
+
+		require.Equal(t, []string{"0"}, messages(t, out.lines()))
+	}
+}
+
+func TestAsyncWriterClose(t *testing.T) {
+	out := newGatedWriter()
+	close(out.gate)
+	w := NewAsyncWriter(out, WithAsyncSummaryInterval(0))
+
+	exitFlushers.mu.Lock()
+	require.Contains(t, exitFlushers.flushers, flusher(w))
+	exitFlushers.mu.Unlock()
+
+	require.NoError(t, w.Close())
+	_, err := w.Write([]byte(`{"message":"0"}` + "\n"))
+	require.Equal(t, ErrAsyncWriterClosed, err)
+
+	exitFlushers.mu.Lock()
+	require.NotContains(t, exitFlushers.flushers, flusher(w))
+	exitFlushers.mu.Unlock()
+}
@@ -0,0 +1,261 @@
+package stackdriver
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/go-stack/stack"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	// stdlibPrefix matches the date, time and file flags of the log package.
+	stdlibPrefix = regexp.MustCompile(`^(\d{4}/\d{2}/\d{2} )?(\d{2}:\d{2}:\d{2}(\.\d+)? )?(\S+\.go:\d+: )?`)
+	// klogHeader matches Lmmdd hh:mm:ss.uuuuuu threadid file:line] msg
+	klogHeader = regexp.MustCompile(`^([IWEF])\d{4} \d{2}:\d{2}:\d{2}\.\d{6}\s+\d+ ([^:\]]+):(\d+)\] ?(.*)$`)
+	// levelPrefix matches [ERROR] msg and ERROR: msg.
+	levelPrefix = regexp.MustCompile(`^(?:\[([A-Za-z]+)\]|([A-Z]+):)\s*(.*)$`)
+)
+
+var klogLevels = map[string]logrus.Level{
+	"I": logrus.InfoLevel,
+	"W": logrus.WarnLevel,
+	"E": logrus.ErrorLevel,
+	"F": logrus.FatalLevel,
+}
+
+// LogBridge is an io.Writer for the standard library log package and other
+// writers of plain text lines. Each line is parsed for a severity and fields
+// and logged through a logrus.Logger, e.g. one using the Formatter:
+//
+//	log.SetFlags(0)
+//	log.SetOutput(stackdriver.NewLogBridge(logger))
+//
+// Recognised are klog headers, [ERROR] and ERROR: prefixes, and JSON and
+// logfmt lines with level and msg keys. The source location is the caller
+// of the log package, or the file and line of a klog header.
+type LogBridge struct {
+	logger       *logrus.Logger
+	defaultLevel logrus.Level
+	stackSkip    []string
+}
+
+// BridgeOption lets you configure the LogBridge.
+type BridgeOption func(*LogBridge)
+
+// WithBridgeLevel sets the level of lines without a recognised severity.
+// Defaults to logrus.InfoLevel.
+func WithBridgeLevel(l logrus.Level) BridgeOption {
+	return func(b *LogBridge) {
+		b.defaultLevel = l
+	}
+}
+
+// WithBridgeStackSkip lets you configure which packages should be skipped
+// for locating the caller, in addition to the log package.
+func WithBridgeStackSkip(v string) BridgeOption {
+	return func(b *LogBridge) {
+		b.stackSkip = append(b.stackSkip, v)
+	}
+}
+
+// NewLogBridge returns a new LogBridge logging through logger.
+func NewLogBridge(logger *logrus.Logger, options ...BridgeOption) *LogBridge {
+	b := &LogBridge{
+		logger:       logger,
+		defaultLevel: logrus.InfoLevel,
+		stackSkip:    []string{"log", "log/slog"},
+	}
+	for _, option := range options {
+		option(b)
+	}
+	return b
+}
+
+// Write logs each line of p.
+func (b *LogBridge) Write(p []byte) (int, error) {
+	location := b.caller()
+
+	scanner := bufio.NewScanner(bytes.NewReader(p))
+	scanner.Buffer(nil, len(p)+1)
+	for scanner.Scan() {
+		line := strings.TrimRightFunc(scanner.Text(), unicode.IsSpace)
+		if line == "" {
+			continue
+		}
+		level, msg, fields, loc := b.parse(line)
+		if loc == nil {
+			loc = location
+		}
+		if loc != nil {
+			fields[KeySourceLocation] = loc
+		}
+		b.logger.WithFields(fields).Log(level, msg)
+	}
+
+	return len(p), nil
+}
+
+// caller returns the location of the first frame outside the skipped
+// packages, starting at the caller of Write.
+func (b *LogBridge) caller() *ReportLocation {
+	for i := 2; ; i++ {
+		c := stack.Caller(i)
+		if _, err := c.MarshalText(); err != nil {
+			return nil
+		}
+		pkg := fmt.Sprintf("%+k", c)
+		parts := strings.SplitN(pkg, "/vendor/", 2)
+		pkg = parts[len(parts)-1]
+
+		var skip bool
+		for _, s := range b.stackSkip {
+			if pkg == s {
+				skip = true
+				break
+			}
+		}
+		if !skip {
+			return callLocation(c)
+		}
+	}
+}
+
+// parse extracts the level, message, fields and, for klog lines, the
+// location from line.
+func (b *LogBridge) parse(line string) (logrus.Level, string, logrus.Fields, *ReportLocation) {
+	line = stdlibPrefix.ReplaceAllString(line, "")
+	fields := logrus.Fields{}
+
+	if m := klogHeader.FindStringSubmatch(line); m != nil {
+		lineNumber, _ := strconv.Atoi(m[3])
+		return klogLevels[m[1]], m[4], fields, &ReportLocation{
+			FilePath:   m[2],
+			LineNumber: lineNumber,
+		}
+	}
+
+	if strings.HasPrefix(line, "{") {
+		var data map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &data); err == nil {
+			level, msg := b.structured(data)
+			for k, v := range data {
+				fields[k] = v
+			}
+			return level, msg, fields, nil
+		}
+	}
+
+	if m := levelPrefix.FindStringSubmatch(line); m != nil {
+		name := m[1]
+		if name == "" {
+			name = m[2]
+		}
+		if level, ok := parseLevel(name); ok {
+			return level, m[3], fields, nil
+		}
+	}
+
+	if data, ok := parseLogfmt(line); ok {
+		level, msg := b.structured(data)
+		for k, v := range data {
+			fields[k] = v
+		}
+		return level, msg, fields, nil
+	}
+
+	return b.defaultLevel, line, fields, nil
+}
+
+// structured removes the level and message keys from data.
+func (b *LogBridge) structured(data map[string]interface{}) (logrus.Level, string) {
+	level := b.defaultLevel
+	for _, key := range []string{"level", "lvl", "severity"} {
+		if name, ok := data[key].(string); ok {
+			if l, ok := parseLevel(name); ok {
+				level = l
+				delete(data, key)
+				break
+			}
+		}
+	}
+
+	var msg string
+	for _, key := range []string{"msg", "message"} {
+		if m, ok := data[key].(string); ok {
+			msg = m
+			delete(data, key)
+			break
+		}
+	}
+
+	return level, msg
+}
+
+// parseLevel parses level names as used by common logging libraries. Panic
+// is logged as Fatal, logging at logrus.PanicLevel would panic.
+func parseLevel(name string) (logrus.Level, bool) {
+	switch strings.ToLower(name) {
+	case "trace", "debug", "dbg":
+		return logrus.DebugLevel, true
+	case "info", "notice":
+		return logrus.InfoLevel, true
+	case "warn", "warning":
+		return logrus.WarnLevel, true
+	case "error", "err":
+		return logrus.ErrorLevel, true
+	case "fatal", "crit", "critical", "panic":
+		return logrus.FatalLevel, true
+	}
+	return 0, false
+}
+
+// parseLogfmt parses key=value pairs with optionally quoted values. It only
+// accepts lines consisting entirely of pairs and holding a level or msg key.
+func parseLogfmt(line string) (map[string]interface{}, bool) {
+	data := map[string]interface{}{}
+	for line != "" {
+		line = strings.TrimLeft(line, " ")
+		eq := strings.IndexByte(line, '=')
+		if eq <= 0 || strings.ContainsAny(line[:eq], ` "`) {
+			return nil, false
+		}
+		key := line[:eq]
+		line = line[eq+1:]
+
+		var val string
+		if strings.HasPrefix(line, `"`) {
+			end := 1
+			for end < len(line) && (line[end] != '"' || line[end-1] == '\\') {
+				end++
+			}
+			if end == len(line) {
+				return nil, false
+			}
+			unquoted, err := strconv.Unquote(line[:end+1])
+			if err != nil {
+				return nil, false
+			}
+			val = unquoted
+			line = line[end+1:]
+		} else {
+			end := strings.IndexByte(line, ' ')
+			if end < 0 {
+				end = len(line)
+			}
+			val = line[:end]
+			line = line[end:]
+		}
+		data[key] = val
+	}
+
+	_, hasLevel := data["level"]
+	_, hasMsg := data["msg"]
+	return data, hasLevel || hasMsg
+}
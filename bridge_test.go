@@ -0,0 +1,125 @@
+package stackdriver
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogBridge(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		line     string
+		severity string
+		message  string
+		data     map[string]interface{}
+	}{
+		{
+			name:     "plain",
+			line:     "server started",
+			severity: "INFO",
+			message:  "server started",
+		},
+		{
+			name:     "bracketed prefix",
+			line:     "[WARN] disk almost full",
+			severity: "WARNING",
+			message:  "disk almost full",
+		},
+		{
+			name:     "colon prefix",
+			line:     "DEBUG: cache miss",
+			severity: "DEBUG",
+			message:  "cache miss",
+		},
+		{
+			name:     "logfmt",
+			line:     `level=warn msg="slow query" duration=3s`,
+			severity: "WARNING",
+			message:  "slow query",
+			data:     map[string]interface{}{"duration": "3s"},
+		},
+		{
+			name:     "json",
+			line:     `{"level":"debug","msg":"retrying","attempt":2}`,
+			severity: "DEBUG",
+			message:  "retrying",
+			data:     map[string]interface{}{"attempt": 2.0},
+		},
+		{
+			name:     "unknown prefix",
+			line:     "HTTP: 200 OK",
+			severity: "INFO",
+			message:  "HTTP: 200 OK",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var out bytes.Buffer
+
+			logger := logrus.New()
+			logger.Out = &out
+			logger.Level = logrus.DebugLevel
+			logger.Formatter = NewFormatter()
+
+			std := log.New(NewLogBridge(logger), "", log.LstdFlags)
+			std.Print(tc.line)
+
+			var got map[string]interface{}
+			require.NoError(t, json.Unmarshal(out.Bytes(), &got))
+
+			require.Equal(t, tc.severity, got["severity"])
+			require.Equal(t, tc.message, got["message"])
+			if tc.data != nil {
+				require.Equal(t, tc.data, got["context"].(map[string]interface{})["data"])
+			}
+			require.Equal(t, "TestLogBridge.func1", got["sourceLocation"].(map[string]interface{})["functionName"])
+		})
+	}
+}
+
+func TestLogBridgeError(t *testing.T) {
+	var out bytes.Buffer
+
+	logger := logrus.New()
+	logger.Out = &out
+	logger.Formatter = NewFormatter()
+
+	std := log.New(NewLogBridge(logger), "", 0)
+	std.Println("[ERROR] connection refused")
+
+	var got map[string]interface{}
+	require.NoError(t, json.Unmarshal(out.Bytes(), &got))
+
+	require.Equal(t, "ERROR", got["severity"])
+	require.Equal(t, "connection refused", got["message"])
+
+	location := got["sourceLocation"].(map[string]interface{})
+	require.Equal(t, "TestLogBridgeError", location["functionName"])
+	require.True(t, strings.HasSuffix(location["filePath"].(string), "bridge_test.go"))
+	require.Equal(t, location, got["context"].(map[string]interface{})["reportLocation"])
+}
+
+func TestLogBridgeKlog(t *testing.T) {
+	var out bytes.Buffer
+
+	logger := logrus.New()
+	logger.Out = &out
+	logger.Formatter = NewFormatter()
+
+	NewLogBridge(logger).Write([]byte("E0101 12:00:00.000000    1234 controller.go:42] sync failed\n"))
+
+	var got map[string]interface{}
+	require.NoError(t, json.Unmarshal(out.Bytes(), &got))
+
+	require.Equal(t, "ERROR", got["severity"])
+	require.Equal(t, "sync failed", got["message"])
+	require.Equal(t, map[string]interface{}{
+		"filePath":   "controller.go",
+		"lineNumber": 42.0,
+	}, got["sourceLocation"])
+}
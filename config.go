@@ -0,0 +1,197 @@
+package stackdriver
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Config holds the settings of a Formatter which can be changed while it
+// is in use, see Formatter.SetConfig.
+type Config struct {
+	// ContextLevel is the level set by WithContextLevel, empty when the
+	// formatter doesn't drop entries.
+	ContextLevel string `json:"contextLevel,omitempty"`
+	// ReportLevel is the least severe level reported to Error Reporting.
+	ReportLevel string `json:"reportLevel"`
+	// StackSkip lists the packages skipped when locating errors.
+	StackSkip []string `json:"stackSkip"`
+	// SamplingRates holds the sampling rates by level of the Sampler, if
+	// any.
+	SamplingRates map[string]float64 `json:"samplingRates,omitempty"`
+}
+
+// runtimeConfig holds the settings replaced by SetConfig. Format loads it
+// once per call, it is never modified once stored.
+type runtimeConfig struct {
+	contextLevel *logrus.Level
+	reportLevel  *logrus.Level
+	stackSkip    []string
+}
+
+func (f *Formatter) stackSkip() []string {
+	if c := f.runtime.Load(); c != nil {
+		return c.stackSkip
+	}
+	return f.StackSkip
+}
+
+func (f *Formatter) reportThreshold() *logrus.Level {
+	if c := f.runtime.Load(); c != nil {
+		return c.reportLevel
+	}
+	return f.reportLevel
+}
+
+func (f *Formatter) levelGate() *logrus.Level {
+	if c := f.runtime.Load(); c != nil {
+		return c.contextLevel
+	}
+	return f.contextLevel
+}
+
+// Config returns the current settings.
+func (f *Formatter) Config() Config {
+	c := Config{
+		ReportLevel: logrus.ErrorLevel.String(),
+		StackSkip:   append([]string(nil), f.stackSkip()...),
+	}
+	if l := f.levelGate(); l != nil {
+		c.ContextLevel = l.String()
+	}
+	if l := f.reportThreshold(); l != nil {
+		c.ReportLevel = l.String()
+	}
+	if f.sampler != nil {
+		c.SamplingRates = map[string]float64{}
+		for l, rate := range f.sampler.Rates() {
+			c.SamplingRates[l.String()] = rate
+		}
+	}
+	return c
+}
+
+// SetConfig validates c and replaces the current settings with it. An
+// empty ContextLevel or ReportLevel keeps the current level and a nil
+// SamplingRates the current rates; StackSkip can't be empty. It is safe to
+// call while entries are formatted.
+func (f *Formatter) SetConfig(c Config) error {
+	rc := runtimeConfig{
+		contextLevel: f.levelGate(),
+		reportLevel:  f.reportThreshold(),
+	}
+
+	if c.ContextLevel != "" {
+		if f.levelGate() == nil {
+			return fmt.Errorf("contextLevel: formatter has no context level")
+		}
+		l, err := logrus.ParseLevel(c.ContextLevel)
+		if err != nil {
+			return fmt.Errorf("contextLevel: %w", err)
+		}
+		rc.contextLevel = &l
+	}
+
+	if c.ReportLevel != "" {
+		l, err := logrus.ParseLevel(c.ReportLevel)
+		if err != nil {
+			return fmt.Errorf("reportLevel: %w", err)
+		}
+		rc.reportLevel = &l
+	}
+
+	if len(c.StackSkip) == 0 {
+		return fmt.Errorf("stackSkip: no packages")
+	}
+	for _, pkg := range c.StackSkip {
+		if strings.TrimSpace(pkg) == "" {
+			return fmt.Errorf("stackSkip: empty package")
+		}
+	}
+	rc.stackSkip = append([]string(nil), c.StackSkip...)
+
+	var rates map[logrus.Level]float64
+	if c.SamplingRates != nil {
+		if f.sampler == nil {
+			return fmt.Errorf("samplingRates: formatter has no sampler")
+		}
+		rates = map[logrus.Level]float64{}
+		for name, rate := range c.SamplingRates {
+			l, err := logrus.ParseLevel(name)
+			if err != nil {
+				return fmt.Errorf("samplingRates: %w", err)
+			}
+			if rate < 0 || rate > 1 {
+				return fmt.Errorf("samplingRates: %s rate %v not between 0 and 1", name, rate)
+			}
+			rates[l] = rate
+		}
+	}
+
+	f.runtime.Store(&rc)
+	if rates != nil {
+		f.sampler.SetRates(rates)
+	}
+	return nil
+}
+
+// adminConfig is the configuration served by ConfigHandler.
+type adminConfig struct {
+	// Level is the level of the logger.
+	Level string `json:"level"`
+	Config
+}
+
+// ConfigHandler returns a http.Handler serving the settings of f and the
+// level of logger as JSON. GET returns them and PUT replaces them; every
+// change is logged with logger. Fields missing from a PUT keep their
+// current value. Protect it like any other admin endpoint.
+func ConfigHandler(f *Formatter, logger *logrus.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			writeConfig(w, adminConfig{Level: logger.GetLevel().String(), Config: f.Config()})
+		case http.MethodPut:
+			previous := adminConfig{Level: logger.GetLevel().String(), Config: f.Config()}
+			c := adminConfig{Level: previous.Level, Config: f.Config()}
+			dec := json.NewDecoder(r.Body)
+			dec.DisallowUnknownFields()
+			if err := dec.Decode(&c); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			level, err := logrus.ParseLevel(c.Level)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("level: %s", err), http.StatusBadRequest)
+				return
+			}
+
+			if err := f.SetConfig(c.Config); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			logger.SetLevel(level)
+
+			current := adminConfig{Level: level.String(), Config: f.Config()}
+			logger.WithFields(logrus.Fields{
+				KeyHTTPRequest: NewHTTPRequest(r),
+				KeyReportError: false,
+				"previous":     previous,
+				"config":       current,
+			}).Warn("logging configuration changed")
+
+			writeConfig(w, current)
+		default:
+			w.Header().Set("Allow", "GET, PUT")
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		}
+	})
+}
+
+func writeConfig(w http.ResponseWriter, c adminConfig) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(c)
+}
@@ -0,0 +1,99 @@
+package stackdriver
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfigHandler(t *testing.T) {
+	var out bytes.Buffer
+
+	logger := logrus.New()
+	logger.Out = &out
+	logger.Formatter = NewFormatter(
+		WithSampler(NewSampler(WithSamplingRate(logrus.DebugLevel, 0.5))),
+	)
+	f := logger.Formatter.(*Formatter)
+	h := ConfigHandler(f, logger)
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.JSONEq(t, `{
+		"level": "info",
+		"reportLevel": "error",
+		"stackSkip": ["github.com/sirupsen/logrus", "github.com/go-logr/logr", "log/slog"],
+		"samplingRates": {"debug": 0.5}
+	}`, rec.Body.String())
+
+	for _, body := range []string{
+		`{"level": "loud", "reportLevel": "error"}`,
+		`{"level": "info", "reportLevel": "error", "contextLevel": "info"}`,
+		`{"level": "info", "reportLevel": "error", "samplingRates": {"debug": 2}}`,
+		`{"level": "info", "reportLevel": "error", "stackSkip": [""]}`,
+		`{"level": "info", "reportLevel": "error", "stackSkip": []}`,
+		`{"level": "info", "reportLevel": "error", "stackSkip": null}`,
+		`{"level": "info", "reportLevel": "error", "unknown": true}`,
+	} {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/", strings.NewReader(body)))
+		require.Equal(t, http.StatusBadRequest, rec.Code, body)
+	}
+	require.Empty(t, out.String())
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/", strings.NewReader(`{
+		"level": "debug",
+		"reportLevel": "warning",
+		"stackSkip": ["github.com/sirupsen/logrus", "example.com/logging"],
+		"samplingRates": {"debug": 1}
+	}`)))
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	require.Equal(t, logrus.DebugLevel, logger.GetLevel())
+	require.Equal(t, Config{
+		ReportLevel:   "warning",
+		StackSkip:     []string{"github.com/sirupsen/logrus", "example.com/logging"},
+		SamplingRates: map[string]float64{"debug": 1},
+	}, f.Config())
+
+	var audit map[string]interface{}
+	require.NoError(t, json.Unmarshal(out.Bytes(), &audit))
+	require.Equal(t, "logging configuration changed", audit["message"])
+	require.NotContains(t, audit["context"], "reportLocation")
+	data := audit["context"].(map[string]interface{})["data"].(map[string]interface{})
+	require.Equal(t, "info", data["previous"].(map[string]interface{})["level"])
+	require.Equal(t, "debug", data["config"].(map[string]interface{})["level"])
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/", nil))
+	require.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+}
+
+func TestConfigHandlerPartial(t *testing.T) {
+	var out bytes.Buffer
+
+	logger := logrus.New()
+	logger.Out = &out
+	logger.Formatter = NewFormatter(WithContextLevel(logrus.WarnLevel))
+	f := logger.Formatter.(*Formatter)
+	h := ConfigHandler(f, logger)
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/", strings.NewReader(`{"reportLevel": "warning"}`)))
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	require.Equal(t, logrus.InfoLevel, logger.GetLevel())
+	require.Equal(t, Config{
+		ContextLevel: "warning",
+		ReportLevel:  "warning",
+		StackSkip:    []string{"github.com/sirupsen/logrus", "github.com/go-logr/logr", "log/slog"},
+	}, f.Config())
+}
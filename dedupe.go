@@ -0,0 +1,171 @@
+package stackdriver
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Deduplicator suppresses repeats of entries reported to Error Reporting.
+// Entries are the same when they have the same message, before the error
+// is appended, the same report location and errors of the same type.
+//
+// The first entry is written, the repeats within the window following it
+// are counted, and once the window has passed they are reported as a copy
+// of the first entry with repeatCount, firstSeen and lastSeen data. The
+// copy is written along with the first entry logged after the window, or by
+// Flush. Call Flush before the program exits, as repeats are lost
+// otherwise; it is also run by the logrus exit handlers before Fatal exits.
+//
+// A Deduplicator is meant to live as long as the process: it stays
+// registered with the logrus exit handlers.
+type Deduplicator struct {
+	window time.Duration
+
+	mu        sync.Mutex
+	seen      map[dedupeKey]*dedupeState
+	nextSweep time.Time
+	sink      sink
+}
+
+type dedupeKey struct {
+	message   string
+	location  ReportLocation
+	errorType string
+}
+
+type dedupeState struct {
+	first     Entry
+	firstSeen time.Time
+	lastSeen  time.Time
+	repeats   int64
+}
+
+// NewDeduplicator returns a new Deduplicator suppressing repeats within
+// window.
+func NewDeduplicator(window time.Duration) *Deduplicator {
+	d := &Deduplicator{
+		window: window,
+		seen:   map[dedupeKey]*dedupeState{},
+	}
+	flushAtExit(d)
+	return d
+}
+
+// Flush writes the entries reporting the repeats counted so far, whether
+// their window has passed or not, where the last deduplicated entry was
+// written. It is safe to call while entries are logged: the entries are
+// logged through the same logrus.Logger, SlogHandler or LogrSink.
+func (d *Deduplicator) Flush() {
+	d.mu.Lock()
+	var due []Entry
+	for key, state := range d.seen {
+		if state.repeats > 0 {
+			due = append(due, state.entry())
+		}
+		delete(d.seen, key)
+	}
+	s := d.sink
+	d.mu.Unlock()
+
+	if s == nil || len(due) == 0 {
+		return
+	}
+	s.writeEntries(due)
+}
+
+// WithDeduplicator lets you configure a Deduplicator suppressing repeated
+// errors written by Format.
+func WithDeduplicator(d *Deduplicator) Option {
+	return func(f *Formatter) {
+		f.deduplicator = d
+	}
+}
+
+// dedupe reports whether ee, formatted from e and written to s, is
+// written, and returns the entries reporting repeats which are due.
+func (d *Deduplicator) dedupe(s sink, e *logrus.Entry, ee Entry) (bool, []Entry) {
+	now := e.Time
+	if now.IsZero() {
+		now = time.Now()
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	// Flush writes where the entries went.
+	if s != nil {
+		d.sink = s
+	}
+
+	var due []Entry
+	if !now.Before(d.nextSweep) {
+		due = d.sweep(now)
+		d.nextSweep = now.Add(d.window / 4)
+	}
+
+	if ee.Context == nil || ee.Context.ReportLocation == nil {
+		return true, due
+	}
+
+	key := dedupeKey{
+		message:  e.Message,
+		location: *ee.Context.ReportLocation,
+	}
+	if group, ok := e.Data[KeyErrorGroup].(string); ok {
+		key.message = group
+	}
+	if err, ok := e.Data[logrus.ErrorKey].(error); ok {
+		key.errorType = fmt.Sprintf("%T", err)
+	}
+
+	if state, ok := d.seen[key]; ok {
+		if now.Sub(state.firstSeen) < d.window {
+			state.repeats++
+			state.lastSeen = now
+			return false, due
+		}
+		if state.repeats > 0 {
+			due = append(due, state.entry())
+		}
+	}
+
+	d.seen[key] = &dedupeState{first: ee, firstSeen: now, lastSeen: now}
+	return true, due
+}
+
+// sweep forgets the entries whose window has passed, and returns the
+// entries reporting their repeats. It must be called with d.mu held.
+func (d *Deduplicator) sweep(now time.Time) []Entry {
+	var due []Entry
+	for key, state := range d.seen {
+		if now.Sub(state.firstSeen) < d.window {
+			continue
+		}
+		if state.repeats > 0 {
+			due = append(due, state.entry())
+		}
+		delete(d.seen, key)
+	}
+	return due
+}
+
+// entry returns the entry reporting the repeats.
+func (s *dedupeState) entry() Entry {
+	ee := s.first
+	context := *ee.Context
+	context.Data = make(map[string]interface{}, len(s.first.Context.Data)+3)
+	for k, v := range s.first.Context.Data {
+		context.Data[k] = v
+	}
+	context.Data["repeatCount"] = s.repeats
+	context.Data["firstSeen"] = s.firstSeen.UTC().Format(time.RFC3339Nano)
+	context.Data["lastSeen"] = s.lastSeen.UTC().Format(time.RFC3339Nano)
+	ee.Context = &context
+	if ee.Timestamp != "" {
+		ee.Timestamp = s.lastSeen.UTC().Format(time.RFC3339Nano)
+	}
+	return ee
+}
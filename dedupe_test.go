@@ -0,0 +1,137 @@
+package stackdriver
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeduplicator(t *testing.T) {
+	var out bytes.Buffer
+
+	logger := logrus.New()
+	logger.Out = &out
+	logger.Formatter = NewFormatter(WithDeduplicator(NewDeduplicator(time.Minute)))
+
+	start := time.Date(2020, 10, 12, 14, 26, 0, 0, time.UTC)
+	for i := 0; i < 4; i++ {
+		logger.WithTime(start.Add(time.Duration(i)*time.Second)).
+			WithField(KeyTrace, fmt.Sprintf("%032x", i+1)).
+			WithError(errors.New("connection refused")).
+			Error("dependency failed")
+	}
+	logger.WithTime(start.Add(time.Second)).Error("other error")
+
+	entries := decodeEntries(t, &out)
+	require.Len(t, entries, 2)
+	require.Equal(t, "dependency failed: connection refused", entries[0]["message"])
+	require.Equal(t, "other error", entries[1]["message"])
+
+	logger.WithTime(start.Add(2 * time.Minute)).Info("later entry")
+
+	entries = decodeEntries(t, &out)
+	require.Len(t, entries, 2)
+	require.Equal(t, "dependency failed: connection refused", entries[0]["message"])
+	require.Equal(t, "00000000000000000000000000000001", entries[0]["logging.googleapis.com/trace"])
+	require.Equal(t, map[string]interface{}{
+		"repeatCount": 3.0,
+		"firstSeen":   "2020-10-12T14:26:00Z",
+		"lastSeen":    "2020-10-12T14:26:03Z",
+	}, entries[0]["context"].(map[string]interface{})["data"])
+	require.Equal(t, "later entry", entries[1]["message"])
+}
+
+func TestDeduplicatorConcurrent(t *testing.T) {
+	var out bytes.Buffer
+
+	logger := logrus.New()
+	logger.Out = &out
+	logger.Formatter = NewFormatter(WithDeduplicator(NewDeduplicator(time.Hour)))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				logger.Error("dependency failed")
+			}
+		}()
+	}
+	wg.Wait()
+
+	require.Len(t, decodeEntries(t, &out), 1)
+}
+
+func TestDeduplicatorFlush(t *testing.T) {
+	var out bytes.Buffer
+
+	logger := logrus.New()
+	logger.Out = &out
+	dedupe := NewDeduplicator(time.Hour)
+	logger.Formatter = NewFormatter(WithDeduplicator(dedupe))
+
+	start := time.Date(2020, 10, 12, 14, 26, 0, 0, time.UTC)
+	for i := 0; i < 3; i++ {
+		logger.WithTime(start.Add(time.Duration(i) * time.Second)).Error("dependency failed")
+	}
+	require.Len(t, decodeEntries(t, &out), 1)
+
+	dedupe.Flush()
+
+	entries := decodeEntries(t, &out)
+	require.Len(t, entries, 1)
+	require.Equal(t, "dependency failed", entries[0]["message"])
+	require.Equal(t, map[string]interface{}{
+		"repeatCount": 2.0,
+		"firstSeen":   "2020-10-12T14:26:00Z",
+		"lastSeen":    "2020-10-12T14:26:02Z",
+	}, entries[0]["context"].(map[string]interface{})["data"])
+
+	// Nothing is left to report.
+	dedupe.Flush()
+	require.Zero(t, out.Len())
+}
+
+func TestDeduplicatorFlushConcurrent(t *testing.T) {
+	// Each logger locks its own output.
+	var logrusOut, slogOut, logrOut bytes.Buffer
+	dedupe := NewDeduplicator(time.Hour)
+	formatter := NewFormatter(WithDeduplicator(dedupe))
+
+	logger := logrus.New()
+	logger.Out = &logrusOut
+	logger.Formatter = formatter
+	slogger := slog.New(NewSlogHandler(&slogOut, formatter))
+	logrLogger := logr.New(NewLogrSink(&logrOut, formatter))
+
+	var wg sync.WaitGroup
+	for _, log := range []func(){
+		func() { logger.Error("boom") },
+		func() { slogger.Error("boom") },
+		func() { logrLogger.Error(errors.New("boom"), "boom") },
+	} {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				log()
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				dedupe.Flush()
+			}
+		}()
+	}
+	wg.Wait()
+}
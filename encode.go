@@ -0,0 +1,142 @@
+package stackdriver
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"time"
+	"unicode/utf8"
+
+	"github.com/sirupsen/logrus"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// maxSafeInteger is the largest integer Cloud Logging can hold without
+// losing precision, it parses numbers as doubles.
+const maxSafeInteger = 1<<53 - 1
+
+// BytesEncoding is how byte slices in the entry data are written.
+type BytesEncoding int
+
+const (
+	// BytesBase64 writes byte slices base64 encoded, like encoding/json.
+	BytesBase64 BytesEncoding = iota
+	// BytesHex writes byte slices hex encoded.
+	BytesHex
+	// BytesUTF8 writes byte slices holding valid UTF-8 as strings, and others
+	// base64 encoded.
+	BytesUTF8
+)
+
+// WithBytesEncoding lets you configure how byte slices are written.
+func WithBytesEncoding(enc BytesEncoding) Option {
+	return func(f *Formatter) {
+		f.BytesEncoding = enc
+	}
+}
+
+// WithEncoder lets you configure how values of the type of example are
+// written. The value returned by fn is marshalled instead.
+func WithEncoder(example interface{}, fn func(interface{}) interface{}) Option {
+	return func(f *Formatter) {
+		if f.encoders == nil {
+			f.encoders = map[reflect.Type]func(interface{}) interface{}{}
+		}
+		f.encoders[reflect.TypeOf(example)] = fn
+	}
+}
+
+// encodeValue returns v as it should be marshalled: lazy values computed,
+// protocol buffer messages in their JSON mapping, errors as their message or
+// rich encoding, durations like "1.5s", times in RFC 3339 in UTC, integers too
+// large for a double as strings, and byte slices in the configured encoding.
+// Nested maps and slices are encoded too.
+func (f *Formatter) encodeValue(v interface{}) interface{} {
+	if v == nil {
+		return nil
+	}
+	if enc, ok := f.encoders[reflect.TypeOf(v)]; ok {
+		return enc(v)
+	}
+
+	switch v := v.(type) {
+	case lazyValue:
+		return f.encodeValue(v.value())
+	case lazyLabels:
+		return v.labels()
+	case proto.Message:
+		if b, err := protojson.Marshal(v); err == nil {
+			return json.RawMessage(b)
+		}
+		return v
+	case error:
+		// Otherwise errors are ignored by `encoding/json`
+		// https://github.com/sirupsen/logrus/issues/137
+		if f.RichErrors {
+			return encodeError(v)
+		}
+		return v.Error()
+	case time.Duration:
+		return strconv.FormatFloat(v.Seconds(), 'f', -1, 64) + "s"
+	case time.Time:
+		return v.UTC().Format(time.RFC3339Nano)
+	case []byte:
+		return f.encodeBytes(v)
+	case int:
+		return safeInt(int64(v))
+	case int64:
+		return safeInt(v)
+	case uint:
+		return safeUint(uint64(v))
+	case uint64:
+		return safeUint(v)
+	case map[string]interface{}:
+		return f.encodeMap(v)
+	case logrus.Fields:
+		return f.encodeMap(v)
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, e := range v {
+			out[i] = f.encodeValue(e)
+		}
+		return out
+	}
+	return v
+}
+
+func (f *Formatter) encodeMap(m map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(m))
+	for k, e := range m {
+		out[k] = f.encodeValue(e)
+	}
+	return out
+}
+
+func (f *Formatter) encodeBytes(b []byte) string {
+	switch f.BytesEncoding {
+	case BytesHex:
+		return hex.EncodeToString(b)
+	case BytesUTF8:
+		if utf8.Valid(b) {
+			return string(b)
+		}
+	}
+	return base64.StdEncoding.EncodeToString(b)
+}
+
+func safeInt(i int64) interface{} {
+	if i > maxSafeInteger || i < -maxSafeInteger {
+		return strconv.FormatInt(i, 10)
+	}
+	return i
+}
+
+func safeUint(u uint64) interface{} {
+	if u > maxSafeInteger {
+		return strconv.FormatUint(u, 10)
+	}
+	return u
+}
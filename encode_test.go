@@ -0,0 +1,93 @@
+package stackdriver
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncodeValues(t *testing.T) {
+	var out bytes.Buffer
+
+	logger := logrus.New()
+	logger.Out = &out
+	logger.Formatter = NewFormatter()
+
+	logger.WithFields(logrus.Fields{
+		"duration": 1500 * time.Millisecond,
+		"minutes":  90 * time.Second,
+		"time":     time.Date(2020, 10, 12, 14, 26, 0, 500, time.FixedZone("CEST", 2*60*60)),
+		"small":    int64(42),
+		"large":    int64(math.MaxInt64),
+		"negative": int64(math.MinInt64),
+		"unsigned": uint64(math.MaxUint64),
+		"bytes":    []byte("hello"),
+		"nested": map[string]interface{}{
+			"list": []interface{}{time.Second, uint64(1 << 60)},
+		},
+	}).Info("my log entry")
+
+	var got map[string]interface{}
+	require.NoError(t, json.Unmarshal(out.Bytes(), &got))
+
+	require.Equal(t, map[string]interface{}{
+		"duration": "1.5s",
+		"minutes":  "90s",
+		"time":     "2020-10-12T12:26:00.0000005Z",
+		"small":    42.0,
+		"large":    "9223372036854775807",
+		"negative": "-9223372036854775808",
+		"unsigned": "18446744073709551615",
+		"bytes":    "aGVsbG8=",
+		"nested": map[string]interface{}{
+			"list": []interface{}{"1s", "1152921504606846976"},
+		},
+	}, got["context"].(map[string]interface{})["data"])
+}
+
+func TestEncodeBytes(t *testing.T) {
+	for enc, want := range map[BytesEncoding]map[string]interface{}{
+		BytesBase64: {"text": "aGVsbG8=", "binary": "/w=="},
+		BytesHex:    {"text": "68656c6c6f", "binary": "ff"},
+		BytesUTF8:   {"text": "hello", "binary": "/w=="},
+	} {
+		var out bytes.Buffer
+
+		logger := logrus.New()
+		logger.Out = &out
+		logger.Formatter = NewFormatter(WithBytesEncoding(enc))
+
+		logger.WithFields(logrus.Fields{
+			"text":   []byte("hello"),
+			"binary": []byte{0xff},
+		}).Info("my log entry")
+
+		var got map[string]interface{}
+		require.NoError(t, json.Unmarshal(out.Bytes(), &got))
+		require.Equal(t, want, got["context"].(map[string]interface{})["data"])
+	}
+}
+
+func TestEncoder(t *testing.T) {
+	var out bytes.Buffer
+
+	logger := logrus.New()
+	logger.Out = &out
+	logger.Formatter = NewFormatter(
+		WithEncoder(net.IP{}, func(v interface{}) interface{} {
+			return v.(net.IP).String()
+		}),
+	)
+
+	logger.WithField("ip", net.IPv4(192, 0, 2, 1)).Info("my log entry")
+
+	var got map[string]interface{}
+	require.NoError(t, json.Unmarshal(out.Bytes(), &got))
+	require.Equal(t, map[string]interface{}{"ip": "192.0.2.1"}, got["context"].(map[string]interface{})["data"])
+}
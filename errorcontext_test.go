@@ -0,0 +1,89 @@
+package stackdriver
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+type userKey struct{}
+
+func TestUser(t *testing.T) {
+	var out bytes.Buffer
+
+	logger := logrus.New()
+	logger.Out = &out
+	logger.Formatter = NewFormatter(
+		WithUserExtractor(func(ctx context.Context) string {
+			user, _ := ctx.Value(userKey{}).(string)
+			return user
+		}),
+	)
+
+	ctx := context.WithValue(context.Background(), userKey{}, "user-from-context")
+
+	for _, tc := range []struct {
+		name  string
+		entry *logrus.Entry
+		want  string
+	}{
+		{name: "field", entry: logger.WithField(KeyUser, "user-from-field"), want: "user-from-field"},
+		{name: "context", entry: logger.WithContext(ctx), want: "user-from-context"},
+		{name: "field over context", entry: logger.WithContext(ctx).WithField(KeyUser, "user-from-field"), want: "user-from-field"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			out.Reset()
+			tc.entry.Error("my log entry")
+
+			var got map[string]interface{}
+			require.NoError(t, json.Unmarshal(out.Bytes(), &got))
+
+			ctx := got["context"].(map[string]interface{})
+			require.Equal(t, tc.want, ctx["user"])
+			require.NotContains(t, ctx, "data")
+		})
+	}
+}
+
+func TestErrorGroup(t *testing.T) {
+	var out bytes.Buffer
+
+	logger := logrus.New()
+	logger.Out = &out
+	logger.Formatter = NewFormatter()
+
+	logger.
+		WithField(KeyErrorGroup, "order not found").
+		WithError(errors.New("no order 1234")).
+		Error("lookup failed")
+
+	var got map[string]interface{}
+	require.NoError(t, json.Unmarshal(out.Bytes(), &got))
+
+	require.Equal(t, "order not found", got["message"])
+	require.Equal(t, map[string]interface{}{
+		"originalMessage": "lookup failed: no order 1234",
+	}, got["context"].(map[string]interface{})["data"])
+}
+
+func TestUserFieldNotPromoted(t *testing.T) {
+	var out bytes.Buffer
+
+	logger := logrus.New()
+	logger.Out = &out
+	logger.Formatter = NewFormatter()
+
+	logger.WithField("user", "alice").Error("my log entry")
+
+	var got map[string]interface{}
+	require.NoError(t, json.Unmarshal(out.Bytes(), &got))
+
+	ctx := got["context"].(map[string]interface{})
+	require.NotContains(t, ctx, "user")
+	require.Equal(t, map[string]interface{}{"user": "alice"}, ctx["data"])
+}
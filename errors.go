@@ -0,0 +1,83 @@
+package stackdriver
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrorWithFields is implemented by errors carrying structured data. With
+// WithRichErrors the fields are merged into the encoded error.
+type ErrorWithFields interface {
+	error
+	Fields() map[string]interface{}
+}
+
+// WithRichErrors encodes errors in the entry data as objects holding the
+// message, the Go type, the chain of wrapped errors, the members of joined
+// errors, the %+v form when it differs from the message, and the fields of
+// errors implementing ErrorWithFields.
+func WithRichErrors() Option {
+	return func(f *Formatter) {
+		f.RichErrors = true
+	}
+}
+
+// encodeError returns the rich encoding of err.
+func encodeError(err error) map[string]interface{} {
+	out := map[string]interface{}{
+		"message": err.Error(),
+		"type":    fmt.Sprintf("%T", err),
+	}
+	if verbose := fmt.Sprintf("%+v", err); verbose != err.Error() {
+		out["verbose"] = verbose
+	}
+
+	var chain []interface{}
+	fields := errorFields(err)
+	for cause := err; ; {
+		if joined, ok := cause.(interface{ Unwrap() []error }); ok {
+			var members []interface{}
+			for _, member := range joined.Unwrap() {
+				if member != nil {
+					members = append(members, encodeError(member))
+				}
+			}
+			out["joined"] = members
+			break
+		}
+		if cause = errors.Unwrap(cause); cause == nil {
+			break
+		}
+		chain = append(chain, map[string]interface{}{
+			"message": cause.Error(),
+			"type":    fmt.Sprintf("%T", cause),
+		})
+		for k, v := range errorFields(cause) {
+			if _, ok := fields[k]; !ok {
+				fields[k] = v
+			}
+		}
+	}
+	if len(chain) > 0 {
+		out["unwrap"] = chain
+	}
+
+	// Our own keys take precedence over the error's fields.
+	for k, v := range fields {
+		if _, ok := out[k]; !ok {
+			out[k] = v
+		}
+	}
+
+	return out
+}
+
+func errorFields(err error) map[string]interface{} {
+	fields := map[string]interface{}{}
+	if fe, ok := err.(ErrorWithFields); ok {
+		for k, v := range fe.Fields() {
+			fields[k] = v
+		}
+	}
+	return fields
+}
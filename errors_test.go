@@ -0,0 +1,87 @@
+package stackdriver
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+type queryError struct {
+	query string
+}
+
+func (e *queryError) Error() string {
+	return "query failed"
+}
+
+func (e *queryError) Fields() map[string]interface{} {
+	return map[string]interface{}{"query": e.query}
+}
+
+func (e *queryError) Format(s fmt.State, verb rune) {
+	if verb == 'v' && s.Flag('+') {
+		fmt.Fprintf(s, "query failed: %s", e.query)
+		return
+	}
+	fmt.Fprint(s, e.Error())
+}
+
+func TestRichErrors(t *testing.T) {
+	var out bytes.Buffer
+
+	logger := logrus.New()
+	logger.Out = &out
+	logger.Formatter = NewFormatter(WithRichErrors())
+
+	err := fmt.Errorf("loading user: %w", &queryError{query: "SELECT 1"})
+	logger.WithField("cause", errors.Join(err, errors.New("timeout"))).WithError(err).Error("my log entry")
+
+	var got map[string]interface{}
+	require.NoError(t, json.Unmarshal(out.Bytes(), &got))
+
+	require.Equal(t, "my log entry: loading user: query failed", got["message"])
+
+	wrapped := map[string]interface{}{
+		"message": "loading user: query failed",
+		"type":    "*fmt.wrapError",
+		"query":   "SELECT 1",
+		"unwrap": []interface{}{
+			map[string]interface{}{"message": "query failed", "type": "*stackdriver.queryError"},
+		},
+	}
+	data := got["context"].(map[string]interface{})["data"].(map[string]interface{})
+	require.Equal(t, wrapped, data["error"])
+	require.Equal(t, map[string]interface{}{
+		"message": "loading user: query failed\ntimeout",
+		"type":    "*errors.joinError",
+		"joined": []interface{}{
+			wrapped,
+			map[string]interface{}{"message": "timeout", "type": "*errors.errorString"},
+		},
+	}, data["cause"])
+}
+
+func TestRichErrorsVerbose(t *testing.T) {
+	var out bytes.Buffer
+
+	logger := logrus.New()
+	logger.Out = &out
+	logger.Formatter = NewFormatter(WithRichErrors())
+
+	logger.WithError(&queryError{query: "SELECT 1"}).Info("my log entry")
+
+	var got map[string]interface{}
+	require.NoError(t, json.Unmarshal(out.Bytes(), &got))
+
+	require.Equal(t, map[string]interface{}{
+		"message": "query failed",
+		"type":    "*stackdriver.queryError",
+		"verbose": "query failed: SELECT 1",
+		"query":   "SELECT 1",
+	}, got["context"].(map[string]interface{})["data"].(map[string]interface{})["error"])
+}
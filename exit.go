@@ -0,0 +1,57 @@
+package stackdriver
+
+import (
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// flusher is implemented by the writers which must be flushed before the
+// process exits.
+type flusher interface {
+	Flush()
+}
+
+// exitFlushers holds the flushers run by the logrus exit handlers. A single
+// handler is registered, as logrus can't remove one, so that closed
+// writers are forgotten instead of being kept alive until the process exits.
+var exitFlushers struct {
+	once     sync.Once
+	mu       sync.Mutex
+	flushers map[flusher]struct{}
+}
+
+// flushAtExit makes the logrus exit handlers flush f, until forgetAtExit is
+// called with it.
+func flushAtExit(f flusher) {
+	exitFlushers.once.Do(func() {
+		logrus.RegisterExitHandler(flushAll)
+	})
+
+	exitFlushers.mu.Lock()
+	defer exitFlushers.mu.Unlock()
+	if exitFlushers.flushers == nil {
+		exitFlushers.flushers = map[flusher]struct{}{}
+	}
+	exitFlushers.flushers[f] = struct{}{}
+}
+
+// forgetAtExit undoes flushAtExit.
+func forgetAtExit(f flusher) {
+	exitFlushers.mu.Lock()
+	defer exitFlushers.mu.Unlock()
+	delete(exitFlushers.flushers, f)
+}
+
+func flushAll() {
+	exitFlushers.mu.Lock()
+	flushers := make([]flusher, 0, len(exitFlushers.flushers))
+	for f := range exitFlushers.flushers {
+		flushers = append(flushers, f)
+	}
+	exitFlushers.mu.Unlock()
+
+	for _, f := range flushers {
+		f.Flush()
+	}
+}
@@ -0,0 +1,63 @@
+package stackdriver
+
+import "github.com/sirupsen/logrus"
+
+// WithFieldKeys lets you configure aliases of KeyTrace, KeySpanID,
+// KeyHTTPRequest or KeyLogID, e.g.
+//
+//	WithFieldKeys(KeyTrace, "trace_id", "traceId", "logging.googleapis.com/trace")
+//
+// The first key found in the entry, starting with field itself, is promoted.
+func WithFieldKeys(field string, aliases ...string) Option {
+	return func(f *Formatter) {
+		if f.fieldKeys == nil {
+			f.fieldKeys = map[string][]string{}
+		}
+		f.fieldKeys[field] = append(f.fieldKeys[field], aliases...)
+	}
+}
+
+// WithKeepPromotedKeys keeps the fields promoted to the entry, such as the
+// trace, in the entry data too.
+func WithKeepPromotedKeys() Option {
+	return func(f *Formatter) {
+		f.KeepPromotedKeys = true
+	}
+}
+
+// promote calls set with the values of field and its aliases until it
+// succeeds, and removes the promoted key from data.
+func (f *Formatter) promote(e *logrus.Entry, data logrus.Fields, field string, set func(interface{}) bool) bool {
+	if f.promoteKey(e, data, field, set) {
+		return true
+	}
+	for _, key := range f.fieldKeys[field] {
+		if f.promoteKey(e, data, key, set) {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *Formatter) promoteKey(e *logrus.Entry, data logrus.Fields, key string, set func(interface{}) bool) bool {
+	val, ok := e.Data[key]
+	if !ok || !set(val) {
+		return false
+	}
+	if !f.KeepPromotedKeys {
+		delete(data, key)
+	}
+	return true
+}
+
+// isFieldKey reports whether key is an alias of a known key.
+func (f *Formatter) isFieldKey(key string) bool {
+	for _, aliases := range f.fieldKeys {
+		for _, alias := range aliases {
+			if alias == key {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,60 @@
+package stackdriver
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFieldKeys(t *testing.T) {
+	var out bytes.Buffer
+
+	logger := logrus.New()
+	logger.Out = &out
+	logger.Formatter = NewFormatter(
+		WithFieldKeys(KeyTrace, "trace_id", "traceId"),
+		WithFieldKeys(KeySpanID, "span_id"),
+		WithFieldKeys(KeyLogID, "log"),
+	)
+
+	logger.WithFields(logrus.Fields{
+		"traceId":  "00000000000000000000000000000002",
+		"trace_id": "00000000000000000000000000000001",
+		"span_id":  "000000000000004a",
+		"log":      "my-log",
+	}).Info("my log entry")
+
+	var got map[string]interface{}
+	require.NoError(t, json.Unmarshal(out.Bytes(), &got))
+	require.Equal(t, "00000000000000000000000000000001", got["logging.googleapis.com/trace"])
+	require.Equal(t, "000000000000004a", got["logging.googleapis.com/spanId"])
+	require.Equal(t, "my-log", got["logName"])
+	require.Equal(t, map[string]interface{}{"traceId": "00000000000000000000000000000002"}, got["context"].(map[string]interface{})["data"])
+}
+
+func TestKeepPromotedKeys(t *testing.T) {
+	var out bytes.Buffer
+
+	logger := logrus.New()
+	logger.Out = &out
+	logger.Formatter = NewFormatter(
+		WithFieldKeys(KeyTrace, "trace_id"),
+		WithKeepPromotedKeys(),
+	)
+
+	logger.WithFields(logrus.Fields{
+		"trace_id": "105445aa7843bc8bf206b12000100000",
+		KeySpanID:  "000000000000004a",
+	}).Info("my log entry")
+
+	var got map[string]interface{}
+	require.NoError(t, json.Unmarshal(out.Bytes(), &got))
+	require.Equal(t, "105445aa7843bc8bf206b12000100000", got["logging.googleapis.com/trace"])
+	require.Equal(t, map[string]interface{}{
+		"trace_id": "105445aa7843bc8bf206b12000100000",
+		KeySpanID:  "000000000000004a",
+	}, got["context"].(map[string]interface{})["data"])
+}
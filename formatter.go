@@ -1,10 +1,13 @@
 package stackdriver
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"reflect"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/go-stack/stack"
@@ -33,12 +36,52 @@ var levelsToSeverity = map[logrus.Level]severity{
 	logrus.PanicLevel: severityAlert,
 }
 
+// severityRank orders severities from least to most severe. Unknown
+// severities rank lowest.
+var severityRank = map[severity]int{
+	severityDebug:    1,
+	severityInfo:     2,
+	severityWarning:  4,
+	severityError:    5,
+	severityCritical: 6,
+	severityAlert:    7,
+}
+
 // Known keys
 const (
 	KeyTrace       = "trace"
 	KeySpanID      = "spanID"
 	KeyHTTPRequest = "httpRequest"
 	KeyLogID       = "logID"
+	// KeySourceLocation holds a *ReportLocation used instead of the
+	// location found by walking the stack.
+	KeySourceLocation = "sourceLocation"
+	// KeyUser identifies the user affected by an error, counted by Error
+	// Reporting. It is namespaced so that existing user fields stay in the
+	// entry data.
+	KeyUser = "context.user"
+	// KeyErrorGroup replaces the message of an error entry, so errors whose
+	// messages contain variable parts end up in the same Error Reporting
+	// group. The original message is kept in the data as originalMessage.
+	KeyErrorGroup = "errorGroup"
+	// KeyReportError holds a bool overriding whether an entry is reported
+	// to Error Reporting.
+	KeyReportError = "reportError"
+	// KeyLabels holds the labels of the entry, a map[string]string or a
+	// LazyLabels value.
+	KeyLabels = "labels"
+	// KeyTraceSampled holds a bool telling whether the trace of the entry
+	// was sampled.
+	KeyTraceSampled = "traceSampled"
+	// KeyTraceProject holds the project of the trace of the entry, when it
+	// isn't the project of the Formatter.
+	KeyTraceProject = "traceProject"
+	// KeyService and KeyServiceVersion override the service of the entry,
+	// e.g. for binaries hosting several services. They are namespaced so
+	// that existing service fields, e.g. naming a downstream service, stay
+	// in the entry data.
+	KeyService        = "serviceContext.service"
+	KeyServiceVersion = "serviceContext.version"
 )
 
 // ServiceContext provides the data about the service we are sending to Google.
@@ -50,6 +93,7 @@ type ServiceContext struct {
 // Entry stores a log entry. More information here: https://cloud.google.com/logging/docs/reference/v2/rest/v2/LogEntry
 type Entry struct {
 	LogName     string       `json:"logName,omitempty"`
+	Resource    *Resource    `json:"resource,omitempty"`
 	Timestamp   string       `json:"timestamp,omitempty"`
 	HTTPRequest *HTTPRequest `json:"httpRequest,omitempty"`
 	// TraceID string, Optional. Same as TraceID, but without the project-path.
@@ -67,12 +111,22 @@ type Entry struct {
 	// For Trace spans, this is the same format that the Trace API v2 uses: a 16-character hexadecimal encoding of an 8-byte array.
 	// Example:
 	// 000000000000004a
-	SpanID         string          `json:"logging.googleapis.com/spanId,omitempty"`
+	SpanID string `json:"logging.googleapis.com/spanId,omitempty"`
+	// TraceSampled tells whether the trace associated with the log entry
+	// was sampled.
+	TraceSampled bool `json:"logging.googleapis.com/trace_sampled,omitempty"`
+	// Type marks entries below ERROR severity as errors for Error Reporting.
+	Type           string          `json:"@type,omitempty"`
 	ServiceContext *ServiceContext `json:"serviceContext,omitempty"`
 	Message        string          `json:"message,omitempty"`
 	Severity       severity        `json:"severity,omitempty"`
 	Context        *Context        `json:"context,omitempty"`
 	SourceLocation *ReportLocation `json:"sourceLocation,omitempty"`
+	// Labels are user-defined labels indexed by Cloud Logging.
+	Labels map[string]string `json:"logging.googleapis.com/labels,omitempty"`
+
+	// invalid holds the problems with the values of the known keys.
+	invalid error
 }
 
 // ReportLocation is the information about where an error occurred.
@@ -87,6 +141,7 @@ type Context struct {
 	Data           map[string]interface{} `json:"data,omitempty"`
 	ReportLocation *ReportLocation        `json:"reportLocation,omitempty"`
 	HTTPRequest    *HTTPRequest           `json:"httpRequest,omitempty"`
+	User           string                 `json:"user,omitempty"`
 }
 
 // HTTPRequest defines details of a request and response to append to a log.
@@ -109,7 +164,46 @@ type Formatter struct {
 	Service   string
 	Version   string
 	ProjectID string
-	StackSkip []string
+	// DefaultLogID is the log of entries without a KeyLogID field.
+	DefaultLogID string
+	StackSkip    []string
+	Resource     *Resource
+	// UserExtractor returns the user of entries logged with a context and
+	// without a KeyUser field.
+	UserExtractor func(context.Context) string
+	// TraceExtractor returns the trace of entries logged with a context and
+	// without a KeyTrace field.
+	TraceExtractor func(context.Context) string
+	// TraceProjectExtractor returns the project of the trace of entries
+	// logged with a context and without a KeyTraceProject field.
+	TraceProjectExtractor func(context.Context) string
+	// ServiceExtractor returns the service of entries logged with a
+	// context, overriding Service and Version.
+	ServiceExtractor func(context.Context) *ServiceContext
+	// RichErrors encodes errors as objects rather than their message.
+	RichErrors bool
+	// BytesEncoding is how byte slices are written.
+	BytesEncoding BytesEncoding
+	// ProtoOutput writes length delimited LogEntry protocol buffers.
+	ProtoOutput bool
+	// KeepPromotedKeys keeps the fields promoted to the entry in its data.
+	KeepPromotedKeys bool
+	// StrictValidation makes Format fail for entries with invalid values
+	// of the known keys.
+	StrictValidation bool
+
+	encoders        map[reflect.Type]func(interface{}) interface{}
+	fieldKeys       map[string][]string
+	packageServices []packageService
+	sampler         *Sampler
+	deduplicator    *Deduplicator
+	traceBuffer     *TraceBuffer
+	contextLevel    *logrus.Level
+	runtime         atomic.Pointer[runtimeConfig]
+	metrics         *Metrics
+	reportLevel     *logrus.Level
+	reportAllow     []ErrorMatcher
+	reportDeny      []ErrorMatcher
 }
 
 // Option lets you configure the Formatter.
@@ -136,6 +230,59 @@ func WithProjectID(i string) Option {
 	}
 }
 
+// WithResource adds the monitored resource to all entries, see DetectResource.
+func WithResource(r *Resource) Option {
+	return func(f *Formatter) {
+		f.Resource = r
+	}
+}
+
+// WithUserExtractor lets you configure how the user affected by an error is
+// found in the context of an entry.
+func WithUserExtractor(fn func(context.Context) string) Option {
+	return func(f *Formatter) {
+		f.UserExtractor = fn
+	}
+}
+
+// WithDefaultLogID lets you configure the log written to by entries without
+// a KeyLogID field, e.g. "requests".
+func WithDefaultLogID(id string) Option {
+	return func(f *Formatter) {
+		f.DefaultLogID = id
+	}
+}
+
+// logName returns the full name of a log given its ID or qualified name.
+// Log IDs are qualified with the project when it is known.
+func (f *Formatter) logName(name string) (string, error) {
+	parent, id, err := parseLogName(name)
+	if err != nil {
+		return "", err
+	}
+	if parent == "" && f.ProjectID != "" {
+		parent = "projects/" + f.ProjectID + "/logs/"
+	}
+	return parent + id, nil
+}
+
+// WithTraceExtractor lets you configure how the trace of an entry is found
+// in its context.
+func WithTraceExtractor(fn func(context.Context) string) Option {
+	return func(f *Formatter) {
+		f.TraceExtractor = fn
+	}
+}
+
+// WithTraceProjectExtractor lets you configure how the project of the trace
+// of an entry is found in its context, e.g. for requests traced in the
+// project of the caller.
+func WithTraceProjectExtractor(fn func(context.Context) string) Option {
+	return func(f *Formatter) {
+		f.TraceProjectExtractor = fn
+	}
+}
+
 // WithStackSkip lets you configure which packages should be skipped for locating the error.
 func WithStackSkip(v string) Option {
 	return func(f *Formatter) {
@@ -148,6 +295,8 @@ func NewFormatter(options ...Option) *Formatter {
 	fmtr := Formatter{
 		StackSkip: []string{
 			"github.com/sirupsen/logrus",
+			"github.com/go-logr/logr",
+			"log/slog",
 		},
 	}
 	for _, option := range options {
@@ -158,7 +307,7 @@ func NewFormatter(options ...Option) *Formatter {
 
 func (f *Formatter) errorOrigin() (stack.Call, error) {
 	skip := func(pkg string) bool {
-		for _, skip := range f.StackSkip {
+		for _, skip := range f.stackSkip() {
 			if pkg == skip {
 				return true
 			}
@@ -183,18 +332,21 @@ func (f *Formatter) errorOrigin() (stack.Call, error) {
 	}
 }
 
+// callLocation returns the location of c.
+func callLocation(c stack.Call) *ReportLocation {
+	lineNumber, _ := strconv.ParseInt(fmt.Sprintf("%d", c), 10, 64)
+	return &ReportLocation{
+		FilePath:     fmt.Sprintf("%+s", c),
+		LineNumber:   int(lineNumber),
+		FunctionName: fmt.Sprintf("%n", c),
+	}
+}
+
 // taken from https://github.com/sirupsen/logrus/blob/0fb945b034620199c178b1b7067672a9f8f69c3a/json_formatter.go#L61
-func replaceErrors(source logrus.Fields) logrus.Fields {
+func (f *Formatter) replaceErrors(source logrus.Fields) logrus.Fields {
 	data := make(logrus.Fields, len(source))
 	for k, v := range source {
-		switch v := v.(type) {
-		case error:
-			// Otherwise errors are ignored by `encoding/json`
-			// https://github.com/sirupsen/logrus/issues/137
-			data[k] = v.Error()
-		default:
-			data[k] = v
-		}
+		data[k] = f.encodeValue(v)
 	}
 	return data
 }
@@ -204,94 +356,304 @@ func (f *Formatter) ToEntry(e *logrus.Entry) Entry {
 	severity := levelsToSeverity[e.Level]
 
 	ee := Entry{
+		Resource: f.Resource,
 		Message:  e.Message,
 		Severity: severity,
 		Context: &Context{
-			Data: replaceErrors(e.Data),
-		},
-		ServiceContext: &ServiceContext{
-			Service: f.Service,
-			Version: f.Version,
+			Data: f.replaceErrors(e.Data),
 		},
 	}
 
-	if val, ok := e.Data[KeyTrace]; ok {
-		if str, ok := val.(string); ok {
-			if f.ProjectID != "" {
-				ee.TraceID = str
-				prefix := fmt.Sprintf("projects/%s/traces/", f.ProjectID)
-				if !strings.HasPrefix(str, prefix) {
-					str = prefix + str
-				}
-			}
-			ee.Trace = str
-			delete(ee.Context.Data, KeyTrace)
+	var warnings []error
+	var traceProject, trace string
+	setTrace := func(val interface{}) bool {
+		str, ok := traceID(val)
+		if !ok {
+			return false
+		}
+		project, id, err := parseTrace(str)
+		if err != nil {
+			warnings = append(warnings, err)
+			return false
+		}
+		traceProject, trace = project, id
+		return true
+	}
+	if !f.promote(e, ee.Context.Data, KeyTrace, setTrace) && f.TraceExtractor != nil && e.Context != nil {
+		if str := f.TraceExtractor(e.Context); str != "" && !setTrace(str) {
+			ee.Context.Data[KeyTrace] = str
+		}
+	}
+	// The project of the trace is the one of the KeyTraceProject field, of
+	// the trace itself, of the context, or of the Formatter, in that order.
+	f.promote(e, ee.Context.Data, KeyTraceProject, func(val interface{}) bool {
+		str, ok := val.(string)
+		if ok && str != "" {
+			traceProject = str
+		}
+		return ok
+	})
+	if traceProject == "" && f.TraceProjectExtractor != nil && e.Context != nil {
+		traceProject = f.TraceProjectExtractor(e.Context)
+	}
+	if traceProject == "" {
+		traceProject = f.ProjectID
+	}
+	if trace != "" {
+		ee.Trace = trace
+		if traceProject != "" {
+			// The bare ID is kept for correlating with local traces.
+			ee.TraceID = trace
+			ee.Trace = fmt.Sprintf("projects/%s/traces/%s", traceProject, trace)
 		}
 	}
 
-	if val, ok := e.Data[KeySpanID]; ok {
-		if str, ok := val.(string); ok {
-			ee.SpanID = str
-			delete(ee.Context.Data, KeySpanID)
+	f.promote(e, ee.Context.Data, KeySpanID, func(val interface{}) bool {
+		str, ok := spanID(val)
+		if !ok {
+			return false
+		}
+		id, err := parseSpanID(str)
+		if err != nil {
+			warnings = append(warnings, err)
+			return false
+		}
+		ee.SpanID = id
+		return true
+	})
+
+	if val, ok := e.Data[KeyTraceSampled]; ok {
+		if sampled, ok := val.(bool); ok {
+			ee.TraceSampled = sampled
+			delete(ee.Context.Data, KeyTraceSampled)
 		}
 	}
 
-	if val, ok := e.Data[KeyHTTPRequest]; ok {
-		if req, ok := val.(*HTTPRequest); ok {
-			ee.HTTPRequest = req
-			ee.Context.HTTPRequest = req
-			delete(ee.Context.Data, KeyHTTPRequest)
+	f.promote(e, ee.Context.Data, KeyHTTPRequest, func(val interface{}) bool {
+		req, ok := val.(*HTTPRequest)
+		ee.HTTPRequest = req
+		ee.Context.HTTPRequest = req
+		return ok
+	})
+
+	f.promote(e, ee.Context.Data, KeyLogID, func(val interface{}) bool {
+		str, ok := val.(string)
+		if !ok {
+			return false
+		}
+		name, err := f.logName(str)
+		if err != nil {
+			warnings = append(warnings, err)
+			return false
+		}
+		ee.LogName = name
+		return true
+	})
+	if ee.LogName == "" && f.DefaultLogID != "" {
+		if name, err := f.logName(f.DefaultLogID); err == nil {
+			ee.LogName = name
+		} else {
+			warnings = append(warnings, err)
 		}
 	}
+	ee.invalid = invalidValues(&ee, warnings)
 
-	if val, ok := e.Data[KeyLogID]; ok {
+	if val, ok := e.Data[KeyUser]; ok {
 		if str, ok := val.(string); ok {
-			ee.LogName = str
-			delete(ee.Context.Data, KeyLogID)
+			ee.Context.User = str
+			delete(ee.Context.Data, KeyUser)
+		}
+	} else if f.UserExtractor != nil && e.Context != nil {
+		ee.Context.User = f.UserExtractor(e.Context)
+	}
+
+	// LazyLabels were computed along with the rest of the data, they must
+	// not be called twice.
+	if _, ok := e.Data[KeyLabels]; ok {
+		if labels, ok := ee.Context.Data[KeyLabels].(map[string]string); ok {
+			ee.Labels = labels
+			delete(ee.Context.Data, KeyLabels)
+		}
+	}
+
+	var location *ReportLocation
+	if val, ok := e.Data[KeySourceLocation]; ok {
+		if loc, ok := val.(*ReportLocation); ok {
+			location = loc
+			ee.SourceLocation = loc
+			delete(ee.Context.Data, KeySourceLocation)
 		}
 	}
 
 	if !skipTimestamp {
-		ee.Timestamp = time.Now().UTC().Format(time.RFC3339Nano)
+		// Entries written later, e.g. by a TraceBuffer, keep their time.
+		t := e.Time
+		if t.IsZero() {
+			t = time.Now()
+		}
+		ee.Timestamp = t.UTC().Format(time.RFC3339Nano)
 	}
 
-	switch severity {
-	case severityError, severityCritical, severityAlert:
+	report := f.shouldReport(e)
+	delete(ee.Context.Data, KeyReportError)
+
+	if report {
 		// https://cloud.google.com/error-reporting/docs/formatting-error-messages
 		// When using WithError(), the error is sent separately, but Error
 		// Reporting expects it to be a part of the message so we append it
 		// instead.
-		if err, ok := ee.Context.Data[logrus.ErrorKey]; ok {
+		// The rich encoding holds more than the message, so it is kept.
+		if err, ok := e.Data[logrus.ErrorKey]; ok {
 			ee.Message = fmt.Sprintf("%s: %s", e.Message, err)
-			delete(ee.Context.Data, logrus.ErrorKey)
+			if !f.RichErrors {
+				delete(ee.Context.Data, logrus.ErrorKey)
+			}
 		} else {
 			ee.Message = e.Message
 		}
 
+		if group, ok := ee.Context.Data[KeyErrorGroup].(string); ok {
+			ee.Context.Data["originalMessage"] = ee.Message
+			ee.Message = group
+			delete(ee.Context.Data, KeyErrorGroup)
+		}
+
 		// Extract report location from call stack.
-		if c, err := f.errorOrigin(); err == nil {
-			lineNumber, _ := strconv.ParseInt(fmt.Sprintf("%d", c), 10, 64)
-			location := &ReportLocation{
-				FilePath:     fmt.Sprintf("%+s", c),
-				LineNumber:   int(lineNumber),
-				FunctionName: fmt.Sprintf("%n", c),
-			}
+		if location != nil {
+			ee.Context.ReportLocation = location
+		} else if c, err := f.errorOrigin(); err == nil {
+			location := callLocation(c)
 			ee.Context.ReportLocation = location
 			ee.SourceLocation = location
 		}
+
+		// Error Reporting only picks up less severe entries with the type
+		// of its error events.
+		if severityRank[severity] < severityRank[severityError] {
+			ee.Type = reportedErrorEventType
+		}
 	}
 
+	if ee.Context.ReportLocation != nil {
+		location = ee.Context.ReportLocation
+	}
+	ee.ServiceContext = f.serviceContext(e, ee.Context.Data, location)
+
 	return ee
 }
 
 // Format formats a logrus entry according to the Stackdriver specifications.
 func (f *Formatter) Format(e *logrus.Entry) ([]byte, error) {
-	ee := f.ToEntry(e)
+	if ee, ok := builtEntry(e); ok {
+		return f.render(ee)
+	}
+
+	var s sink
+	if e.Logger != nil {
+		s = loggerSink{e.Logger}
+	}
+	out, keep, forced, err := f.admit(s, e)
+	if err != nil || !keep {
+		return out, err
+	}
+	return f.emit(out, s, e, f.ToEntry(e), forced)
+}
+
+// admit reports whether e, written to s, is formatted, before ToEntry
+// computes its fields, and whether it is only because of the level
+// override of its context. out holds the sampling summary to write first,
+// if any.
+func (f *Formatter) admit(s sink, e *logrus.Entry) (out []byte, keep, forced bool, err error) {
+	keep, forced = f.forceLevel(e)
+	if !keep {
+		return nil, false, false, nil
+	}
+
+	if f.sampler != nil && !forced {
+		keep, summary := f.sampler.sample(f, s, e, f.sampledTrace(e))
+		if summary != nil {
+			if out, err = f.render(f.ToEntry(summary)); err != nil {
+				return nil, false, false, err
+			}
+		}
+		if !keep {
+			f.metrics.sampledOut()
+			return out, false, false, nil
+		}
+	}
+	return out, true, forced, nil
+}
+
+// emit returns out followed by ee, built by ToEntry from an entry accepted
+// by admit, and the entries the trace buffer and the deduplicator release
+// along with it. s is where the output goes, used by the deduplicator to
+// write the repeats left at shutdown.
+func (f *Formatter) emit(out []byte, s sink, e *logrus.Entry, ee Entry, forced bool) ([]byte, error) {
+	if f.StrictValidation && ee.invalid != nil {
+		f.metrics.failed()
+		return nil, ee.invalid
+	}
+
+	if forced {
+		labels := make(map[string]string, len(ee.Labels)+1)
+		for k, v := range ee.Labels {
+			labels[k] = v
+		}
+		labels[debugForcedLabel] = "true"
+		ee.Labels = labels
+	}
+
+	if f.traceBuffer != nil && !forced {
+		keep, buffered := f.traceBuffer.buffer(e.Level, ee)
+		for _, entry := range buffered {
+			b, err := f.render(entry)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, b...)
+		}
+		if !keep {
+			return out, nil
+		}
+	}
 
-	b, err := json.Marshal(ee)
+	if f.deduplicator != nil {
+		keep, repeats := f.deduplicator.dedupe(s, e, ee)
+		for _, repeat := range repeats {
+			b, err := f.render(repeat)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, b...)
+		}
+		if !keep {
+			f.metrics.deduplicatedOut()
+			return out, nil
+		}
+	}
+
+	b, err := f.render(ee)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(out, b...), nil
+}
+
+// render returns ee as it is written by Format and the sinks.
+func (f *Formatter) render(ee Entry) ([]byte, error) {
+	var b []byte
+	var err error
+	if f.ProtoOutput {
+		b, err = f.formatProto(ee)
+	} else if b, err = json.Marshal(ee); err == nil {
+		b = append(b, '\n')
+	}
 	if err != nil {
+		f.metrics.failed()
 		return nil, err
 	}
 
-	return append(b, '\n'), nil
+	f.metrics.written(ee.Severity, len(b))
+	return b, nil
 }
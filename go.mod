@@ -1,10 +1,28 @@
 module github.com/shortcut/logrus-stackdriver-formatter
 
-go 1.15
+go 1.23
 
 require (
+	cloud.google.com/go/logging v1.13.0
+	github.com/go-logr/logr v1.4.2
 	github.com/go-stack/stack v1.8.0
 	github.com/kr/pretty v0.2.1
 	github.com/sirupsen/logrus v1.8.1
-	github.com/stretchr/testify v1.7.0
+	github.com/stretchr/testify v1.9.0
+	google.golang.org/genproto v0.0.0-20241118233622-e639e219e697
+	google.golang.org/protobuf v1.36.12
+)
+
+require (
+	cloud.google.com/go/longrunning v0.6.2 // indirect
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/kr/text v0.1.0 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+	golang.org/x/net v0.33.0 // indirect
+	golang.org/x/sys v0.28.0 // indirect
+	golang.org/x/text v0.21.0 // indirect
+	google.golang.org/genproto/googleapis/api v0.0.0-20241118233622-e639e219e697 // indirect
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20241209162323-e6fa225c2576 // indirect
+	google.golang.org/grpc v1.67.3 // indirect
+	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
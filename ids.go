@@ -0,0 +1,72 @@
+package stackdriver
+
+import (
+	"encoding/hex"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+const (
+	traceIDSize = 16
+	spanIDSize  = 8
+)
+
+// traceID returns the trace of a KeyTrace value: strings as they are, and
+// identifiers such as OpenTelemetry's trace.TraceID, [16]byte or
+// fmt.Stringer values as 32 lowercase hex digits.
+func traceID(v interface{}) (string, bool) {
+	return hexID(v, traceIDSize)
+}
+
+// spanID returns the span of a KeySpanID value: strings as they are, and
+// identifiers such as OpenTelemetry's trace.SpanID, [8]byte, uint64 or
+// fmt.Stringer values as 16 lowercase hex digits.
+func spanID(v interface{}) (string, bool) {
+	if u, ok := v.(uint64); ok {
+		return canonicalID(strconv.FormatUint(u, 16), spanIDSize)
+	}
+	return hexID(v, spanIDSize)
+}
+
+// hexID returns v as the hex encoding of an identifier of size bytes. Empty
+// and all-zero identifiers are invalid.
+func hexID(v interface{}, size int) (string, bool) {
+	switch v := v.(type) {
+	case string:
+		return v, true
+	case []byte:
+		if len(v) != size {
+			return "", false
+		}
+		return canonicalID(hex.EncodeToString(v), size)
+	}
+
+	// Byte arrays, including named ones like OpenTelemetry's.
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Array && rv.Type().Elem().Kind() == reflect.Uint8 {
+		if rv.Len() != size {
+			return "", false
+		}
+		b := make([]byte, size)
+		reflect.Copy(reflect.ValueOf(b), rv)
+		return canonicalID(hex.EncodeToString(b), size)
+	}
+
+	if s, ok := v.(fmt.Stringer); ok {
+		return canonicalID(s.String(), size)
+	}
+	return "", false
+}
+
+// canonicalID returns s as 2*size lowercase hex digits, padding shorter
+// values with zeros.
+func canonicalID(s string, size int) (string, bool) {
+	s = strings.ToLower(s)
+	if s == "" || len(s) > 2*size {
+		return "", false
+	}
+	s = strings.Repeat("0", 2*size-len(s)) + s
+	return s, isHexID(s, size)
+}
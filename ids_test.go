@@ -0,0 +1,87 @@
+package stackdriver
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+// otelTraceID and otelSpanID are shaped like OpenTelemetry's identifiers.
+type otelTraceID [16]byte
+
+func (t otelTraceID) String() string { return hex.EncodeToString(t[:]) }
+
+type otelSpanID [8]byte
+
+func (s otelSpanID) String() string { return hex.EncodeToString(s[:]) }
+
+type stringer string
+
+func (s stringer) String() string { return string(s) }
+
+func TestIDs(t *testing.T) {
+	trace := otelTraceID{0x10, 0x54, 0x45, 0xaa, 0x78, 0x43, 0xbc, 0x8b, 0xf2, 0x06, 0xb1, 0x20, 0x00, 0x10, 0x00, 0x00}
+
+	for _, tc := range []struct {
+		trace, span interface{}
+		wantTrace   interface{}
+		wantSpan    interface{}
+		wantData    interface{}
+	}{
+		{
+			trace:     trace,
+			span:      otelSpanID{0, 0, 0, 0, 0, 0, 0, 0x4a},
+			wantTrace: "105445aa7843bc8bf206b12000100000",
+			wantSpan:  "000000000000004a",
+		},
+		{
+			trace:     [16]byte(trace),
+			span:      uint64(0x4a),
+			wantTrace: "105445aa7843bc8bf206b12000100000",
+			wantSpan:  "000000000000004a",
+		},
+		{
+			trace:     stringer("105445AA7843BC8BF206B12000100000"),
+			span:      []byte{0, 0, 0, 0, 0, 0, 0, 0x4a},
+			wantTrace: "105445aa7843bc8bf206b12000100000",
+			wantSpan:  "000000000000004a",
+		},
+		{
+			trace: otelTraceID{},
+			span:  uint64(0),
+			wantData: map[string]interface{}{
+				KeyTrace:  []interface{}{0.0, 0.0, 0.0, 0.0, 0.0, 0.0, 0.0, 0.0, 0.0, 0.0, 0.0, 0.0, 0.0, 0.0, 0.0, 0.0},
+				KeySpanID: 0.0,
+			},
+		},
+		{
+			trace: stringer("not a trace"),
+			span:  []byte{0x4a},
+			wantData: map[string]interface{}{
+				KeyTrace:  "not a trace",
+				KeySpanID: "Sg==",
+			},
+		},
+	} {
+		var out bytes.Buffer
+
+		logger := logrus.New()
+		logger.Out = &out
+		logger.Formatter = NewFormatter()
+
+		logger.WithFields(logrus.Fields{
+			KeyTrace:  tc.trace,
+			KeySpanID: tc.span,
+		}).Info("my log entry")
+
+		var got map[string]interface{}
+		require.NoError(t, json.Unmarshal(out.Bytes(), &got))
+		require.Equal(t, tc.wantTrace, got["logging.googleapis.com/trace"])
+		require.Equal(t, tc.wantSpan, got["logging.googleapis.com/spanId"])
+		require.Equal(t, tc.wantData, got["context"].(map[string]interface{})["data"])
+	}
+}
@@ -0,0 +1,59 @@
+package stackdriver
+
+import "fmt"
+
+// lazyValue is a field value computed when the entry is formatted.
+type lazyValue struct {
+	fn func() interface{}
+}
+
+// lazyLabels are labels computed when the entry is formatted.
+type lazyLabels struct {
+	fn func() map[string]string
+}
+
+// Lazy returns a field value computed by fn only when the entry is
+// formatted, so expensive values cost nothing for entries which are never
+// written:
+//
+//	log.WithField("diff", stackdriver.Lazy(func() interface{} {
+//		return cmp.Diff(before, after)
+//	})).Debug("updated")
+//
+// A panic in fn is recovered and its value written instead.
+func Lazy(fn func() interface{}) interface{} {
+	return lazyValue{fn}
+}
+
+// LazyLabels returns a KeyLabels value computed by fn only when the entry
+// is formatted. A panic in fn is recovered and leaves the entry without
+// labels.
+func LazyLabels(fn func() map[string]string) interface{} {
+	return lazyLabels{fn}
+}
+
+// value calls fn, recovering panics.
+func (l lazyValue) value() (v interface{}) {
+	if l.fn == nil {
+		return nil
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			v = fmt.Sprintf("panic: %v", r)
+		}
+	}()
+	return l.fn()
+}
+
+// labels calls fn, recovering panics.
+func (l lazyLabels) labels() (labels map[string]string) {
+	if l.fn == nil {
+		return nil
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			labels = nil
+		}
+	}()
+	return l.fn()
+}
@@ -0,0 +1,75 @@
+package stackdriver
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLazy(t *testing.T) {
+	var out bytes.Buffer
+
+	logger := logrus.New()
+	logger.Out = &out
+	logger.Formatter = NewFormatter()
+
+	var calls int
+	lazy := Lazy(func() interface{} {
+		calls++
+		return map[string]interface{}{"took": time.Second}
+	})
+
+	logger.WithField("payload", lazy).Debug("dropped")
+	require.Equal(t, 0, calls)
+	require.Empty(t, out.String())
+
+	logger.WithFields(logrus.Fields{
+		"payload": lazy,
+		"broken": Lazy(func() interface{} {
+			panic("boom")
+		}),
+	}).Info("my log entry")
+	require.Equal(t, 1, calls)
+
+	var got map[string]interface{}
+	require.NoError(t, json.Unmarshal(out.Bytes(), &got))
+	require.Equal(t, map[string]interface{}{
+		"payload": map[string]interface{}{"took": "1s"},
+		"broken":  "panic: boom",
+	}, got["context"].(map[string]interface{})["data"])
+}
+
+func TestLabels(t *testing.T) {
+	var out bytes.Buffer
+
+	logger := logrus.New()
+	logger.Out = &out
+	logger.Formatter = NewFormatter()
+
+	logger.WithField(KeyLabels, map[string]string{"tenant": "acme"}).Info("my log entry")
+	var calls int
+	logger.WithField(KeyLabels, LazyLabels(func() map[string]string {
+		calls++
+		return map[string]string{"tenant": "lazy"}
+	})).Info("my log entry")
+	require.Equal(t, 1, calls)
+	logger.WithField(KeyLabels, LazyLabels(func() map[string]string {
+		panic("boom")
+	})).Info("my log entry")
+
+	dec := json.NewDecoder(&out)
+	for _, want := range []interface{}{
+		map[string]interface{}{"tenant": "acme"},
+		map[string]interface{}{"tenant": "lazy"},
+		nil,
+	} {
+		var got map[string]interface{}
+		require.NoError(t, dec.Decode(&got))
+		require.Equal(t, want, got["logging.googleapis.com/labels"])
+		require.NotContains(t, got["context"], "data")
+	}
+}
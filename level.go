@@ -0,0 +1,163 @@
+package stackdriver
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// DefaultDebugHeader is the header read by DebugLevelHandler.
+const DefaultDebugHeader = "X-Debug-Log"
+
+// debugForcedLabel marks entries written because of a level override.
+const debugForcedLabel = "debug_forced"
+
+type levelContextKey struct{}
+
+// ContextWithLevel returns a copy of ctx overriding the level of the
+// entries logged with it, see WithContextLevel.
+func ContextWithLevel(ctx context.Context, l logrus.Level) context.Context {
+	return context.WithValue(ctx, levelContextKey{}, l)
+}
+
+// LevelFromContext returns the level override of ctx, if any.
+func LevelFromContext(ctx context.Context) (logrus.Level, bool) {
+	if ctx == nil {
+		return 0, false
+	}
+	l, ok := ctx.Value(levelContextKey{}).(logrus.Level)
+	return l, ok
+}
+
+// WithContextLevel makes Format drop the entries less severe than l, unless
+// they are logged with a context whose level override lets them through.
+// Those entries get a debug_forced label. The level of the logger must let
+// them through too, e.g. with logger.SetLevel(logrus.DebugLevel).
+func WithContextLevel(l logrus.Level) Option {
+	return func(f *Formatter) {
+		f.contextLevel = &l
+	}
+}
+
+// DebugHeaderOption lets you configure DebugLevelHandler.
+type DebugHeaderOption func(*debugHeaderConfig)
+
+type debugHeaderConfig struct {
+	header string
+	values map[string]logrus.Level
+	key    []byte
+	now    func() time.Time
+}
+
+// WithDebugHeaderName sets the header read. Defaults to DefaultDebugHeader.
+func WithDebugHeaderName(name string) DebugHeaderOption {
+	return func(c *debugHeaderConfig) {
+		c.header = name
+	}
+}
+
+// WithDebugHeaderValue allows the header value v, overriding the level with
+// l.
+func WithDebugHeaderValue(v string, l logrus.Level) DebugHeaderOption {
+	return func(c *debugHeaderConfig) {
+		c.values[v] = l
+	}
+}
+
+// WithDebugHeaderKey allows header values signed with key by
+// SignDebugHeader.
+func WithDebugHeaderKey(key []byte) DebugHeaderOption {
+	return func(c *debugHeaderConfig) {
+		c.key = key
+	}
+}
+
+// DebugLevelHandler wraps h, overriding the level of the request context
+// when the debug header holds an allowed or validly signed value. Without
+// options no value is accepted.
+func DebugLevelHandler(h http.Handler, options ...DebugHeaderOption) http.Handler {
+	c := debugHeaderConfig{
+		header: DefaultDebugHeader,
+		values: map[string]logrus.Level{},
+		now:    time.Now,
+	}
+	for _, option := range options {
+		option(&c)
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if v := r.Header.Get(c.header); v != "" {
+			if l, ok := c.level(v); ok {
+				r = r.WithContext(ContextWithLevel(r.Context(), l))
+			}
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// SignDebugHeader returns a header value for DebugLevelHandler overriding
+// the level with l until expiry, signed with key.
+func SignDebugHeader(key []byte, l logrus.Level, expiry time.Time) string {
+	payload := fmt.Sprintf("%s:%d", l, expiry.Unix())
+	return payload + ":" + debugHeaderSignature(key, payload)
+}
+
+// level returns the level override of the header value v.
+func (c *debugHeaderConfig) level(v string) (logrus.Level, bool) {
+	if l, ok := c.values[v]; ok {
+		return l, true
+	}
+	if c.key == nil {
+		return 0, false
+	}
+
+	i := strings.LastIndex(v, ":")
+	if i < 0 {
+		return 0, false
+	}
+	payload, signature := v[:i], v[i+1:]
+	if !hmac.Equal([]byte(signature), []byte(debugHeaderSignature(c.key, payload))) {
+		return 0, false
+	}
+
+	parts := strings.SplitN(payload, ":", 2)
+	if len(parts) != 2 {
+		return 0, false
+	}
+	expiry, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil || c.now().Unix() > expiry {
+		return 0, false
+	}
+	l, err := logrus.ParseLevel(parts[0])
+	if err != nil {
+		return 0, false
+	}
+	return l, true
+}
+
+func debugHeaderSignature(key []byte, payload string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(payload))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// forceLevel reports whether e is written, and whether it is written only
+// because of the level override of its context.
+func (f *Formatter) forceLevel(e *logrus.Entry) (keep, forced bool) {
+	gate := f.levelGate()
+	if gate == nil || e.Level <= *gate {
+		return true, false
+	}
+	if l, ok := LevelFromContext(e.Context); ok && e.Level <= l {
+		return true, true
+	}
+	return false, false
+}
@@ -0,0 +1,62 @@
+package stackdriver
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+func TestContextLevel(t *testing.T) {
+	var out bytes.Buffer
+
+	logger := logrus.New()
+	logger.Out = &out
+	logger.Level = logrus.DebugLevel
+	logger.Formatter = NewFormatter(WithContextLevel(logrus.InfoLevel))
+
+	key := []byte("secret")
+	h := DebugLevelHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		entry := logger.WithContext(r.Context())
+		entry.Debug("debug entry")
+		entry.Info("info entry")
+	}),
+		WithDebugHeaderValue("1", logrus.DebugLevel),
+		WithDebugHeaderKey(key),
+	)
+
+	for _, header := range []string{
+		"",
+		"0",
+		"1",
+		SignDebugHeader(key, logrus.DebugLevel, time.Now().Add(time.Hour)),
+		SignDebugHeader(key, logrus.DebugLevel, time.Now().Add(-time.Hour)),
+		SignDebugHeader([]byte("other"), logrus.DebugLevel, time.Now().Add(time.Hour)),
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if header != "" {
+			req.Header.Set(DefaultDebugHeader, header)
+		}
+		h.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	var got []interface{}
+	for _, entry := range decodeEntries(t, &out) {
+		got = append(got, []interface{}{entry["message"], entry["logging.googleapis.com/labels"]})
+	}
+	forced := map[string]interface{}{"debug_forced": "true"}
+	require.Equal(t, []interface{}{
+		[]interface{}{"info entry", nil},
+		[]interface{}{"info entry", nil},
+		[]interface{}{"debug entry", forced},
+		[]interface{}{"info entry", nil},
+		[]interface{}{"debug entry", forced},
+		[]interface{}{"info entry", nil},
+		[]interface{}{"info entry", nil},
+		[]interface{}{"info entry", nil},
+	}, got)
+}
@@ -0,0 +1,198 @@
+package stackdriver
+
+import (
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/go-logr/logr"
+	"github.com/sirupsen/logrus"
+)
+
+// LogrSink is a logr.LogSink producing the same entries as the Formatter.
+// V-levels are mapped onto logrus levels, and so severities, through a
+// configurable table. Error entries are reported to Error Reporting like
+// logrus entries logged with WithError.
+type LogrSink struct {
+	formatter *Formatter
+	levels    []logrus.Level
+	threshold logrus.Level
+	nameKey   string
+
+	mu  *sync.Mutex
+	out io.Writer
+
+	name   string
+	values logrus.Fields
+}
+
+// defaultLogrLevels maps V(0) to Info and everything above to Debug.
+var defaultLogrLevels = []logrus.Level{logrus.InfoLevel, logrus.DebugLevel}
+
+// LogrOption lets you configure the LogrSink.
+type LogrOption func(*LogrSink)
+
+// WithLogrLevels sets the logrus level of each V-level, starting at V(0).
+// V-levels beyond the table use its last level. Defaults to Info for V(0)
+// and Debug for everything above, also used when levels is empty.
+func WithLogrLevels(levels ...logrus.Level) LogrOption {
+	return func(s *LogrSink) {
+		s.levels = levels
+	}
+}
+
+// WithLogrThreshold sets the least severe logrus level written. Defaults
+// to logrus.InfoLevel.
+func WithLogrThreshold(l logrus.Level) LogrOption {
+	return func(s *LogrSink) {
+		s.threshold = l
+	}
+}
+
+// WithLogrNameKey sets the field holding the logger name built by WithName.
+// Defaults to "logger".
+func WithLogrNameKey(key string) LogrOption {
+	return func(s *LogrSink) {
+		s.nameKey = key
+	}
+}
+
+// NewLogrSink returns a new LogrSink writing entries formatted by f to out.
+// Use logr.New to create a logr.Logger from it.
+func NewLogrSink(out io.Writer, f *Formatter, options ...LogrOption) *LogrSink {
+	s := &LogrSink{
+		formatter: f,
+		levels:    defaultLogrLevels,
+		threshold: logrus.InfoLevel,
+		nameKey:   "logger",
+		mu:        &sync.Mutex{},
+		out:       out,
+		values:    logrus.Fields{},
+	}
+	for _, option := range options {
+		option(s)
+	}
+	if len(s.levels) == 0 {
+		s.levels = defaultLogrLevels
+	}
+	return s
+}
+
+// Init is a no-op, the call site is found like for logrus entries, by
+// walking the stack past StackSkip.
+func (s *LogrSink) Init(logr.RuntimeInfo) {}
+
+// level returns the logrus level of V-level v.
+func (s *LogrSink) level(v int) logrus.Level {
+	if v >= len(s.levels) {
+		v = len(s.levels) - 1
+	}
+	return s.levels[v]
+}
+
+// Enabled reports whether entries at V-level v are written.
+func (s *LogrSink) Enabled(v int) bool {
+	return s.level(v) <= s.threshold
+}
+
+// Info writes a non-error entry at V-level v.
+func (s *LogrSink) Info(v int, msg string, keysAndValues ...interface{}) {
+	e := s.entry(s.level(v), msg, nil, keysAndValues)
+	out, keep, forced, err := s.formatter.admit(s, e)
+	if err == nil && keep {
+		// ToEntry must be called from here, errorOrigin skips a fixed
+		// number of frames before walking past the logr ones.
+		out, err = s.formatter.emit(out, s, e, s.formatter.ToEntry(e), forced)
+	}
+	s.write(out, err)
+}
+
+// Error writes an ERROR entry for err.
+func (s *LogrSink) Error(err error, msg string, keysAndValues ...interface{}) {
+	e := s.entry(logrus.ErrorLevel, msg, err, keysAndValues)
+	out, keep, forced, ferr := s.formatter.admit(s, e)
+	if ferr == nil && keep {
+		out, ferr = s.formatter.emit(out, s, e, s.formatter.ToEntry(e), forced)
+	}
+	s.write(out, ferr)
+}
+
+// WithValues returns a sink adding keysAndValues to all entries.
+func (s *LogrSink) WithValues(keysAndValues ...interface{}) logr.LogSink {
+	s2 := *s
+	s2.values = make(logrus.Fields, len(s.values)+len(keysAndValues)/2)
+	for k, v := range s.values {
+		s2.values[k] = v
+	}
+	addKeysAndValues(s2.values, keysAndValues)
+	return &s2
+}
+
+// WithName returns a sink with name appended to the logger name.
+func (s *LogrSink) WithName(name string) logr.LogSink {
+	s2 := *s
+	if s.name != "" {
+		name = s.name + "/" + name
+	}
+	s2.name = name
+	return &s2
+}
+
+func (s *LogrSink) entry(level logrus.Level, msg string, err error, keysAndValues []interface{}) *logrus.Entry {
+	data := make(logrus.Fields, len(s.values)+len(keysAndValues)/2+2)
+	for k, v := range s.values {
+		data[k] = v
+	}
+	addKeysAndValues(data, keysAndValues)
+	if s.name != "" {
+		data[s.nameKey] = s.name
+	}
+	if err != nil {
+		data[logrus.ErrorKey] = err
+	}
+
+	return &logrus.Entry{
+		Data:    data,
+		Level:   level,
+		Message: msg,
+	}
+}
+
+// write writes the output of the formatter, unless formatting failed:
+// logr has no way to report the error.
+func (s *LogrSink) write(out []byte, err error) {
+	if err != nil || len(out) == 0 {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.out.Write(out)
+}
+
+// writeEntries writes entries built outside of Info and Error, see sink.
+func (s *LogrSink) writeEntries(entries []Entry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, ee := range entries {
+		if b, err := s.formatter.render(ee); err == nil {
+			s.out.Write(b)
+		}
+	}
+}
+
+// addKeysAndValues adds logr style key/value pairs to data. A key without a
+// value is kept with a nil value.
+func addKeysAndValues(data logrus.Fields, keysAndValues []interface{}) {
+	for i := 0; i < len(keysAndValues); i += 2 {
+		key, ok := keysAndValues[i].(string)
+		if !ok {
+			key = fmt.Sprint(keysAndValues[i])
+		}
+		var val interface{}
+		if i+1 < len(keysAndValues) {
+			val = keysAndValues[i+1]
+		}
+		data[key] = val
+	}
+}
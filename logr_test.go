@@ -0,0 +1,99 @@
+package stackdriver
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogrSink(t *testing.T) {
+	var out bytes.Buffer
+
+	logger := logr.New(NewLogrSink(&out, NewFormatter(
+		WithService("test"),
+		WithVersion("0.1"),
+	)))
+
+	logger.WithName("controller").WithName("pods").
+		WithValues("foo", "bar").
+		Error(errors.New("test error"), "my log entry", "pod", "my-pod")
+
+	var got map[string]interface{}
+	require.NoError(t, json.Unmarshal(out.Bytes(), &got))
+
+	require.Equal(t, "ERROR", got["severity"])
+	require.Equal(t, "my log entry: test error", got["message"])
+
+	ctx := got["context"].(map[string]interface{})
+	require.Equal(t, map[string]interface{}{
+		"foo":    "bar",
+		"pod":    "my-pod",
+		"logger": "controller/pods",
+	}, ctx["data"])
+	require.Equal(t, "TestLogrSink", ctx["reportLocation"].(map[string]interface{})["functionName"])
+}
+
+func TestLogrSinkLevels(t *testing.T) {
+	var out bytes.Buffer
+
+	logger := logr.New(NewLogrSink(&out, NewFormatter(),
+		WithLogrLevels(logrus.WarnLevel, logrus.InfoLevel, logrus.DebugLevel),
+		WithLogrThreshold(logrus.InfoLevel),
+	))
+
+	for v, want := range map[int]string{0: "WARNING", 1: "INFO", 2: "", 5: ""} {
+		out.Reset()
+		logger.V(v).Info("my log entry")
+
+		if want == "" {
+			require.Zero(t, out.Len(), "V(%d)", v)
+			continue
+		}
+		var got map[string]interface{}
+		require.NoError(t, json.Unmarshal(out.Bytes(), &got))
+		require.Equal(t, want, got["severity"], "V(%d)", v)
+	}
+}
+
+func TestLogrSinkPipeline(t *testing.T) {
+	var out bytes.Buffer
+
+	metrics := &Metrics{}
+	logger := logr.New(NewLogrSink(&out, NewFormatter(
+		WithMetrics(metrics),
+		WithSampler(NewSampler(WithSamplingRate(logrus.InfoLevel, 0))),
+		WithDeduplicator(NewDeduplicator(time.Hour)),
+	)))
+
+	logger.Info("sampled entry")
+	for i := 0; i < 2; i++ {
+		logger.Error(errors.New("test error"), "error entry")
+	}
+
+	require.Equal(t, []string{"error entry: test error"}, messages(t, strings.Split(strings.TrimSpace(out.String()), "\n")))
+	snapshot := metrics.Snapshot()
+	require.Equal(t, int64(1), snapshot["entries"].(map[string]int64)["ERROR"])
+	require.Equal(t, int64(out.Len()), snapshot["bytes"])
+	require.Equal(t, int64(1), snapshot["sampledEntries"])
+	require.Equal(t, int64(1), snapshot["deduplicatedEntries"])
+}
+
+func TestLogrSinkNoLevels(t *testing.T) {
+	var out bytes.Buffer
+
+	logger := logr.New(NewLogrSink(&out, NewFormatter(), WithLogrLevels()))
+	logger.V(1).Info("dropped")
+	require.Zero(t, out.Len())
+
+	logger.Info("my log entry")
+	var got map[string]interface{}
+	require.NoError(t, json.Unmarshal(out.Bytes(), &got))
+	require.Equal(t, "INFO", got["severity"])
+}
@@ -0,0 +1,119 @@
+package stackdriver
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultMetadataEndpoint is the base URL of the GCE metadata server.
+const DefaultMetadataEndpoint = "http://metadata.google.internal/computeMetadata/v1"
+
+// metadataEndpoint returns the metadata server base URL, honouring the
+// GCE_METADATA_HOST environment variable used by the Google client libraries.
+func metadataEndpoint() string {
+	if host := os.Getenv("GCE_METADATA_HOST"); host != "" {
+		return "http://" + host + "/computeMetadata/v1"
+	}
+	return DefaultMetadataEndpoint
+}
+
+// metadataClient queries the metadata server.
+type metadataClient struct {
+	endpoint string
+	client   *http.Client
+}
+
+func newMetadataClient(endpoint string) *metadataClient {
+	if endpoint == "" {
+		endpoint = metadataEndpoint()
+	}
+	return &metadataClient{
+		endpoint: strings.TrimSuffix(endpoint, "/"),
+		client:   &http.Client{Timeout: 2 * time.Second},
+	}
+}
+
+func (c *metadataClient) get(path string) (string, error) {
+	req, err := http.NewRequest(http.MethodGet, c.endpoint+"/"+strings.TrimPrefix(path, "/"), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+
+	res, err := c.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	b, err := ioutil.ReadAll(io.LimitReader(res.Body, 1<<20))
+	if err != nil {
+		return "", err
+	}
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("stackdriver: metadata %s: %s", path, res.Status)
+	}
+	return strings.TrimSpace(string(b)), nil
+}
+
+// TokenSource supplies OAuth2 access tokens for the Cloud Logging API.
+type TokenSource interface {
+	Token() (string, error)
+}
+
+// TokenSourceFunc adapts a function to a TokenSource.
+type TokenSourceFunc func() (string, error)
+
+// Token returns f().
+func (f TokenSourceFunc) Token() (string, error) {
+	return f()
+}
+
+// MetadataTokenSource returns a TokenSource fetching tokens for the default
+// service account from the metadata server at endpoint. An empty endpoint
+// uses the default metadata server.
+func MetadataTokenSource(endpoint string) TokenSource {
+	return &metadataTokenSource{metadata: newMetadataClient(endpoint)}
+}
+
+type metadataTokenSource struct {
+	metadata *metadataClient
+
+	mu     sync.Mutex
+	token  string
+	expiry time.Time
+}
+
+func (s *metadataTokenSource) Token() (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Refresh a little early so in-flight requests don't use a stale token.
+	if s.token != "" && time.Now().Add(time.Minute).Before(s.expiry) {
+		return s.token, nil
+	}
+
+	body, err := s.metadata.get("instance/service-accounts/default/token")
+	if err != nil {
+		return "", err
+	}
+
+	var tok struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.Unmarshal([]byte(body), &tok); err != nil {
+		return "", fmt.Errorf("stackdriver: decoding metadata token: %w", err)
+	}
+
+	s.token = tok.AccessToken
+	s.expiry = time.Now().Add(time.Duration(tok.ExpiresIn) * time.Second)
+	return s.token, nil
+}
@@ -0,0 +1,123 @@
+package stackdriver
+
+import (
+	"expvar"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+)
+
+// metricSeverities are the severities counted by Metrics, in order.
+var metricSeverities = []severity{
+	severityDebug,
+	severityInfo,
+	severityWarning,
+	severityError,
+	severityCritical,
+	severityAlert,
+}
+
+// Metrics counts what a Formatter writes, and the entries dropped by the
+// AsyncWriter and APIWriter configured with it. Counters are updated
+// atomically and can be shared by several formatters and writers.
+type Metrics struct {
+	entries      [8]atomic.Int64
+	bytes        atomic.Int64
+	failures     atomic.Int64
+	sampled      atomic.Int64
+	deduplicated atomic.Int64
+	dropped      atomic.Int64
+}
+
+// WithMetrics lets you configure Metrics counting the entries written by
+// Format.
+func WithMetrics(m *Metrics) Option {
+	return func(f *Formatter) {
+		f.metrics = m
+	}
+}
+
+// written counts an entry of b bytes.
+func (m *Metrics) written(s severity, b int) {
+	if m == nil {
+		return
+	}
+	m.entries[severityRank[s]].Add(1)
+	m.bytes.Add(int64(b))
+}
+
+func (m *Metrics) failed() {
+	if m != nil {
+		m.failures.Add(1)
+	}
+}
+
+func (m *Metrics) sampledOut() {
+	if m != nil {
+		m.sampled.Add(1)
+	}
+}
+
+func (m *Metrics) deduplicatedOut() {
+	if m != nil {
+		m.deduplicated.Add(1)
+	}
+}
+
+// droppedOut counts n entries dropped by a writer.
+func (m *Metrics) droppedOut(n int64) {
+	if m != nil {
+		m.dropped.Add(n)
+	}
+}
+
+// Snapshot returns the current values of the counters.
+func (m *Metrics) Snapshot() map[string]interface{} {
+	entries := map[string]int64{}
+	for _, s := range metricSeverities {
+		entries[string(s)] = m.entries[severityRank[s]].Load()
+	}
+	return map[string]interface{}{
+		"entries":             entries,
+		"bytes":               m.bytes.Load(),
+		"formatErrors":        m.failures.Load(),
+		"sampledEntries":      m.sampled.Load(),
+		"deduplicatedEntries": m.deduplicated.Load(),
+		"droppedEntries":      m.dropped.Load(),
+	}
+}
+
+// Publish exports the counters with expvar under name. Like expvar.Publish
+// it panics if name is already in use.
+func (m *Metrics) Publish(name string) {
+	expvar.Publish(name, expvar.Func(func() interface{} {
+		return m.Snapshot()
+	}))
+}
+
+// Handler returns a http.Handler serving the counters in the Prometheus
+// text format.
+func (m *Metrics) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+
+		fmt.Fprintln(w, "# HELP stackdriver_entries_total Log entries written by severity.")
+		fmt.Fprintln(w, "# TYPE stackdriver_entries_total counter")
+		for _, s := range metricSeverities {
+			fmt.Fprintf(w, "stackdriver_entries_total{severity=%q} %d\n", s, m.entries[severityRank[s]].Load())
+		}
+
+		for _, c := range []struct {
+			name, help string
+			value      int64
+		}{
+			{"stackdriver_bytes_total", "Bytes of log entries written.", m.bytes.Load()},
+			{"stackdriver_format_errors_total", "Log entries which failed to format.", m.failures.Load()},
+			{"stackdriver_sampled_entries_total", "Log entries dropped by the sampler.", m.sampled.Load()},
+			{"stackdriver_deduplicated_entries_total", "Log entries suppressed by the deduplicator.", m.deduplicated.Load()},
+			{"stackdriver_dropped_entries_total", "Log entries dropped by the writers.", m.dropped.Load()},
+		} {
+			fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n%s %d\n", c.name, c.help, c.name, c.name, c.value)
+		}
+	})
+}
@@ -0,0 +1,92 @@
+package stackdriver
+
+import (
+	"bytes"
+	"encoding/json"
+	"expvar"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetrics(t *testing.T) {
+	var out bytes.Buffer
+
+	metrics := &Metrics{}
+
+	logger := logrus.New()
+	logger.Out = &out
+	logger.Level = logrus.DebugLevel
+	logger.Formatter = NewFormatter(
+		WithMetrics(metrics),
+		WithSampler(NewSampler(WithSamplingRate(logrus.DebugLevel, 0))),
+		WithDeduplicator(NewDeduplicator(time.Hour)),
+	)
+
+	logger.Info("info entry")
+	logger.Warn("warning entry")
+	logger.Debug("sampled entry")
+	for i := 0; i < 3; i++ {
+		logger.Error("error entry")
+	}
+	logger.WithField("broken", json.RawMessage("{")).Info("broken entry")
+
+	require.Equal(t, map[string]interface{}{
+		"entries": map[string]int64{
+			"DEBUG":    0,
+			"INFO":     1,
+			"WARNING":  1,
+			"ERROR":    1,
+			"CRITICAL": 0,
+			"ALERT":    0,
+		},
+		"bytes":               int64(out.Len()),
+		"formatErrors":        int64(1),
+		"sampledEntries":      int64(1),
+		"deduplicatedEntries": int64(2),
+		"droppedEntries":      int64(0),
+	}, metrics.Snapshot())
+
+	metrics.Publish("stackdriver_test")
+	require.JSONEq(t, mustMarshal(t, metrics.Snapshot()), expvar.Get("stackdriver_test").String())
+
+	rec := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	require.Contains(t, rec.Body.String(), "# TYPE stackdriver_entries_total counter\n")
+	require.Contains(t, rec.Body.String(), "stackdriver_entries_total{severity=\"ERROR\"} 1\n")
+	require.Contains(t, rec.Body.String(), "stackdriver_deduplicated_entries_total 2\n")
+}
+
+func TestMetricsDropped(t *testing.T) {
+	metrics := &Metrics{}
+
+	out := newGatedWriter()
+	async := NewAsyncWriter(out, WithAsyncQueueSize(1), WithAsyncOverflow(OverflowDropOldest), WithAsyncSummaryInterval(0), WithAsyncMetrics(metrics))
+	fillQueue(async,
+		`{"message":"0","severity":"INFO"}`+"\n",
+		`{"message":"1","severity":"INFO"}`+"\n",
+		`{"message":"2","severity":"INFO"}`+"\n",
+	)
+	close(out.gate)
+	async.Close()
+
+	api := NewAPIWriter("my-project", WithAPIBufferLimit(10), WithAPIMetrics(metrics))
+	defer api.Close()
+	api.Write([]byte(`{"message":"a long enough entry"}`))
+
+	require.EqualValues(t, 2, metrics.Snapshot()["droppedEntries"])
+
+	rec := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	require.Contains(t, rec.Body.String(), "stackdriver_dropped_entries_total 2\n")
+}
+
+func mustMarshal(t *testing.T, v interface{}) string {
+	b, err := json.Marshal(v)
+	require.NoError(t, err)
+	return string(b)
+}
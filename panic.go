@@ -0,0 +1,149 @@
+package stackdriver
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"runtime/debug"
+	"strings"
+
+	"github.com/go-stack/stack"
+	"github.com/sirupsen/logrus"
+)
+
+// RecoverOption lets you configure how panics are reported.
+type RecoverOption func(*recoverConfig)
+
+type recoverConfig struct {
+	repanic     bool
+	httpRequest *HTTPRequest
+}
+
+// WithRepanic panics again with the recovered value once it is reported.
+func WithRepanic() RecoverOption {
+	return func(c *recoverConfig) {
+		c.repanic = true
+	}
+}
+
+// WithRecoverHTTPRequest attaches r to the reported entry.
+func WithRecoverHTTPRequest(r *HTTPRequest) RecoverOption {
+	return func(c *recoverConfig) {
+		c.httpRequest = r
+	}
+}
+
+// RecoverAndReport recovers a panic and logs it as an ERROR entry Error
+// Reporting understands: the message holds the panic value and the stack
+// trace in the format of the Go runtime, and the report location is the
+// panicking frame. It must be deferred directly:
+//
+//	defer stackdriver.RecoverAndReport(logger)
+func RecoverAndReport(logger *logrus.Logger, options ...RecoverOption) {
+	if v := recover(); v != nil {
+		reportPanic(logger, v, options)
+	}
+}
+
+// RecoverHandler wraps h, reporting panics with RecoverAndReport and the
+// request attached. The client gets a 500 unless WithRepanic is given.
+func RecoverHandler(logger *logrus.Logger, h http.Handler, options ...RecoverOption) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			if v := recover(); v != nil {
+				reportPanic(logger, v, append([]RecoverOption{WithRecoverHTTPRequest(NewHTTPRequest(r))}, options...))
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			}
+		}()
+		h.ServeHTTP(w, r)
+	})
+}
+
+// RecoverHandlerFunc is RecoverHandler for a http.HandlerFunc.
+func RecoverHandlerFunc(logger *logrus.Logger, h http.HandlerFunc, options ...RecoverOption) http.HandlerFunc {
+	return RecoverHandler(logger, h, options...).ServeHTTP
+}
+
+// NewHTTPRequest returns the HTTPRequest describing r.
+func NewHTTPRequest(r *http.Request) *HTTPRequest {
+	remoteIP := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		remoteIP = host
+	}
+	return &HTTPRequest{
+		RequestMethod: r.Method,
+		RequestURL:    r.URL.String(),
+		UserAgent:     r.UserAgent(),
+		RemoteIP:      remoteIP,
+		Referer:       r.Referer(),
+		Protocol:      r.Proto,
+	}
+}
+
+// reportPanic logs v and panics again if configured to.
+func reportPanic(logger *logrus.Logger, v interface{}, options []RecoverOption) {
+	var c recoverConfig
+	for _, option := range options {
+		option(&c)
+	}
+
+	// net/http uses this to abort a response, it isn't an error.
+	if v == http.ErrAbortHandler {
+		panic(v)
+	}
+
+	fields := logrus.Fields{}
+	if loc := panicLocation(); loc != nil {
+		fields[KeySourceLocation] = loc
+	}
+	if c.httpRequest != nil {
+		fields[KeyHTTPRequest] = c.httpRequest
+	}
+
+	logger.WithFields(fields).Error(fmt.Sprintf("panic: %v\n\n%s", v, panicStack(debug.Stack())))
+
+	if c.repanic {
+		panic(v)
+	}
+}
+
+// panicLocation returns the location of the frame which panicked, the first
+// one outside the runtime below runtime.gopanic.
+func panicLocation() *ReportLocation {
+	var panicking bool
+	for _, c := range stack.Trace() {
+		fn := fmt.Sprintf("%+n", c)
+		if fn == "runtime.gopanic" {
+			panicking = true
+			continue
+		}
+		if panicking && !strings.HasPrefix(fn, "runtime.") {
+			return callLocation(c)
+		}
+	}
+	return nil
+}
+
+// panicStack removes the frames of the recovering code from a stack trace
+// returned by debug.Stack, so it starts at the panicking frame like the one
+// printed by the runtime for an unrecovered panic.
+func panicStack(trace []byte) string {
+	lines := strings.Split(strings.TrimRight(string(trace), "\n"), "\n")
+	if len(lines) < 3 {
+		return string(trace)
+	}
+
+	// The header is followed by pairs of function and file lines.
+	header, frames := lines[0], lines[1:]
+	for i := 0; i+1 < len(frames); i += 2 {
+		if strings.HasPrefix(frames[i], "panic(") {
+			frames = frames[i+2:]
+			for len(frames) > 1 && strings.HasPrefix(frames[0], "runtime.") {
+				frames = frames[2:]
+			}
+			break
+		}
+	}
+
+	return header + "\n" + strings.Join(frames, "\n") + "\n"
+}
@@ -0,0 +1,93 @@
+package stackdriver
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+func panicking() {
+	panic("something went wrong")
+}
+
+func TestRecoverAndReport(t *testing.T) {
+	var out bytes.Buffer
+
+	logger := logrus.New()
+	logger.Out = &out
+	logger.Formatter = NewFormatter(
+		WithService("test"),
+		WithVersion("0.1"),
+	)
+
+	func() {
+		defer RecoverAndReport(logger)
+		panicking()
+	}()
+
+	var got map[string]interface{}
+	require.NoError(t, json.Unmarshal(out.Bytes(), &got))
+
+	require.Equal(t, "ERROR", got["severity"])
+
+	msg := got["message"].(string)
+	require.Regexp(t, regexp.MustCompile(`^panic: something went wrong\n\ngoroutine \d+ \[running\]:\n`), msg)
+	frames := strings.SplitN(msg, "[running]:\n", 2)[1]
+	require.True(t, strings.HasPrefix(frames, "github.com/shortcut/logrus-stackdriver-formatter.panicking("), frames)
+
+	location := got["context"].(map[string]interface{})["reportLocation"].(map[string]interface{})
+	require.Equal(t, "panicking", location["functionName"])
+	require.Equal(t, location, got["sourceLocation"])
+}
+
+func TestRecoverAndReportRepanic(t *testing.T) {
+	var out bytes.Buffer
+
+	logger := logrus.New()
+	logger.Out = &out
+	logger.Formatter = NewFormatter()
+
+	require.PanicsWithValue(t, "something went wrong", func() {
+		defer RecoverAndReport(logger, WithRepanic())
+		panicking()
+	})
+	require.Contains(t, out.String(), "panic: something went wrong")
+}
+
+func TestRecoverHandler(t *testing.T) {
+	var out bytes.Buffer
+
+	logger := logrus.New()
+	logger.Out = &out
+	logger.Formatter = NewFormatter()
+
+	h := RecoverHandler(logger, http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		panicking()
+	}))
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/items", nil)
+	req.Header.Set("User-Agent", "test-agent")
+	h.ServeHTTP(rec, req)
+
+	require.Equal(t, http.StatusInternalServerError, rec.Code)
+
+	var got map[string]interface{}
+	require.NoError(t, json.Unmarshal(out.Bytes(), &got))
+
+	require.Equal(t, map[string]interface{}{
+		"requestMethod": "POST",
+		"requestUrl":    "/items",
+		"userAgent":     "test-agent",
+		"remoteIp":      "192.0.2.1",
+		"protocol":      "HTTP/1.1",
+	}, got["httpRequest"])
+	require.Equal(t, "panicking", got["sourceLocation"].(map[string]interface{})["functionName"])
+}
@@ -28,7 +28,7 @@ func TestProject(t *testing.T) {
 	json.Unmarshal(out.Bytes(), &got)
 
 	want := map[string]interface{}{
-		"logName":  "my-id",
+		"logName":  "projects/my-project-id/logs/my-id",
 		"severity": "INFO",
 		"message":  "my log entry",
 		"context":  map[string]interface{}{},
@@ -41,3 +41,41 @@ func TestProject(t *testing.T) {
 	require.True(t, reflect.DeepEqual(got, want), "unexpected output = %# v; \n want = %# v; \n diff: %# v", pretty.Formatter(got), pretty.Formatter(want), pretty.Diff(got, want))
 
 }
+
+func TestLogName(t *testing.T) {
+	for _, tc := range []struct {
+		projectID, defaultLogID string
+		logID                   interface{}
+		want                    interface{}
+	}{
+		{projectID: "my-project", logID: "requests", want: "projects/my-project/logs/requests"},
+		{projectID: "my-project", logID: "a/b", want: "projects/my-project/logs/a%2Fb"},
+		{logID: "requests", want: "requests"},
+		{projectID: "my-project", logID: "projects/other/logs/requests", want: "projects/other/logs/requests"},
+		{projectID: "my-project", logID: "folders/123/logs/a/b", want: "folders/123/logs/a%2Fb"},
+		{projectID: "my-project", logID: "organizations/123/logs/audit", want: "organizations/123/logs/audit"},
+		{projectID: "my-project", logID: "billingAccounts/0123-4567/logs/audit", want: "billingAccounts/0123-4567/logs/audit"},
+		{projectID: "my-project", defaultLogID: "audit", want: "projects/my-project/logs/audit"},
+		{projectID: "my-project", defaultLogID: "audit", logID: "requests", want: "projects/my-project/logs/requests"},
+		{projectID: "my-project"},
+	} {
+		var out bytes.Buffer
+
+		logger := logrus.New()
+		logger.Out = &out
+		logger.Formatter = NewFormatter(
+			WithProjectID(tc.projectID),
+			WithDefaultLogID(tc.defaultLogID),
+		)
+
+		entry := logrus.NewEntry(logger)
+		if tc.logID != nil {
+			entry = entry.WithField(KeyLogID, tc.logID)
+		}
+		entry.Info("my log entry")
+
+		var got map[string]interface{}
+		require.NoError(t, json.Unmarshal(out.Bytes(), &got))
+		require.Equal(t, tc.want, got["logName"], tc)
+	}
+}
@@ -0,0 +1,64 @@
+package stackdriver
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"cloud.google.com/go/logging/apiv2/loggingpb"
+	"google.golang.org/protobuf/encoding/protodelim"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// WithProtoOutput makes Format write entries as google.logging.v2.LogEntry
+// protocol buffers, each preceded by its varint encoded length, rather than
+// JSON lines. Use it for binary log archives.
+func WithProtoOutput() Option {
+	return func(f *Formatter) {
+		f.ProtoOutput = true
+	}
+}
+
+// LogEntry returns ee as a google.logging.v2.LogEntry for the Cloud Logging
+// API. The fields without a LogEntry counterpart, including the message and
+// the context, make up its jsonPayload.
+func (ee Entry) LogEntry() (*loggingpb.LogEntry, error) {
+	b, err := json.Marshal(ee)
+	if err != nil {
+		return nil, err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+
+	var payload map[string]interface{}
+	if err := dec.Decode(&payload); err != nil {
+		return nil, err
+	}
+
+	b, err = json.Marshal(logEntryJSON(payload))
+	if err != nil {
+		return nil, err
+	}
+
+	var le loggingpb.LogEntry
+	if err := (protojson.UnmarshalOptions{DiscardUnknown: true}).Unmarshal(b, &le); err != nil {
+		return nil, err
+	}
+
+	return &le, nil
+}
+
+// formatProto returns ee as a length delimited LogEntry.
+func (f *Formatter) formatProto(ee Entry) ([]byte, error) {
+	le, err := ee.LogEntry()
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if _, err := protodelim.MarshalTo(&buf, le); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,84 @@
+package stackdriver
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/logging/apiv2/loggingpb"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+	ltype "google.golang.org/genproto/googleapis/logging/type"
+	"google.golang.org/protobuf/encoding/protodelim"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+func TestEncodeProtoMessage(t *testing.T) {
+	var out bytes.Buffer
+
+	logger := logrus.New()
+	logger.Out = &out
+	logger.Formatter = NewFormatter()
+
+	logger.WithFields(logrus.Fields{
+		"timeout": durationpb.New(1500 * time.Millisecond),
+		"request": &loggingpb.ListLogsRequest{Parent: "projects/my-project", PageSize: 10},
+	}).Info("my log entry")
+
+	var got map[string]interface{}
+	require.NoError(t, json.Unmarshal(out.Bytes(), &got))
+	require.Equal(t, map[string]interface{}{
+		"timeout": "1.500s",
+		"request": map[string]interface{}{
+			"parent":   "projects/my-project",
+			"pageSize": 10.0,
+		},
+	}, got["context"].(map[string]interface{})["data"])
+}
+
+func TestProtoOutput(t *testing.T) {
+	var out bytes.Buffer
+
+	logger := logrus.New()
+	logger.Out = &out
+	logger.Formatter = NewFormatter(
+		WithProjectID("my-project"),
+		WithProtoOutput(),
+	)
+
+	logger.WithFields(logrus.Fields{
+		KeyTrace:  "105445aa7843bc8bf206b12000100000",
+		KeySpanID: "000000000000004a",
+		KeyLogID:  "my-log",
+		KeyHTTPRequest: &HTTPRequest{
+			RequestMethod: "GET",
+			Status:        "200",
+		},
+		"foo": "bar",
+	}).Warn("my log entry")
+	logger.Info("second entry")
+
+	r := bytes.NewReader(out.Bytes())
+
+	var le loggingpb.LogEntry
+	require.NoError(t, protodelim.UnmarshalFrom(r, &le))
+
+	require.Equal(t, "projects/my-project/logs/my-log", le.LogName)
+	require.Equal(t, ltype.LogSeverity_WARNING, le.Severity)
+	require.Equal(t, "projects/my-project/traces/105445aa7843bc8bf206b12000100000", le.Trace)
+	require.Equal(t, "000000000000004a", le.SpanId)
+	require.Equal(t, "GET", le.HttpRequest.RequestMethod)
+	require.Equal(t, int32(200), le.HttpRequest.Status)
+
+	payload := le.GetJsonPayload().AsMap()
+	require.Equal(t, "my log entry", payload["message"])
+	require.Equal(t, map[string]interface{}{"foo": "bar"}, payload["context"].(map[string]interface{})["data"])
+	require.NotContains(t, payload, "severity")
+
+	le.Reset()
+	require.NoError(t, protodelim.UnmarshalFrom(r, &le))
+	require.Equal(t, ltype.LogSeverity_INFO, le.Severity)
+	require.Equal(t, structpb.NewStringValue("second entry"), le.GetJsonPayload().Fields["message"])
+}
@@ -0,0 +1,83 @@
+package stackdriver
+
+import (
+	"errors"
+	"reflect"
+
+	"github.com/sirupsen/logrus"
+)
+
+// reportedErrorEventType marks entries below ERROR severity as errors for
+// Error Reporting.
+const reportedErrorEventType = "type.googleapis.com/google.devtools.clouderrorreporting.v1beta1.ReportedErrorEvent"
+
+// ErrorMatcher reports whether an error belongs to a class of errors.
+type ErrorMatcher func(error) bool
+
+// ErrorIs matches errors for which errors.Is(err, target) holds.
+func ErrorIs(target error) ErrorMatcher {
+	return func(err error) bool {
+		return errors.Is(err, target)
+	}
+}
+
+// ErrorAs matches errors for which errors.As would succeed with a pointer
+// to the type of target, e.g. ErrorAs((*ValidationError)(nil)).
+func ErrorAs(target interface{}) ErrorMatcher {
+	typ := reflect.TypeOf(target)
+	return func(err error) bool {
+		return errors.As(err, reflect.New(typ).Interface())
+	}
+}
+
+// WithReportLevel lets you configure the least severe level reported to
+// Error Reporting. Defaults to logrus.ErrorLevel.
+func WithReportLevel(l logrus.Level) Option {
+	return func(f *Formatter) {
+		f.reportLevel = &l
+	}
+}
+
+// WithReportErrors lets you configure errors which are reported to Error
+// Reporting whatever the level of the entry.
+func WithReportErrors(matchers ...ErrorMatcher) Option {
+	return func(f *Formatter) {
+		f.reportAllow = append(f.reportAllow, matchers...)
+	}
+}
+
+// WithoutReportErrors lets you configure errors which are never reported to
+// Error Reporting, e.g. cancelled requests.
+func WithoutReportErrors(matchers ...ErrorMatcher) Option {
+	return func(f *Formatter) {
+		f.reportDeny = append(f.reportDeny, matchers...)
+	}
+}
+
+// shouldReport decides whether e is reported to Error Reporting. A
+// KeyReportError field takes precedence over the errors denied, the errors
+// allowed and the level, in that order.
+func (f *Formatter) shouldReport(e *logrus.Entry) bool {
+	if report, ok := e.Data[KeyReportError].(bool); ok {
+		return report
+	}
+
+	if err, ok := e.Data[logrus.ErrorKey].(error); ok {
+		for _, match := range f.reportDeny {
+			if match(err) {
+				return false
+			}
+		}
+		for _, match := range f.reportAllow {
+			if match(err) {
+				return true
+			}
+		}
+	}
+
+	level := logrus.ErrorLevel
+	if l := f.reportThreshold(); l != nil {
+		level = *l
+	}
+	return e.Level <= level
+}
@@ -0,0 +1,116 @@
+package stackdriver
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+type validationError struct {
+	field string
+}
+
+func (e *validationError) Error() string {
+	return "invalid " + e.field
+}
+
+func TestReportPolicy(t *testing.T) {
+	errDependency := errors.New("dependency down")
+
+	for _, tc := range []struct {
+		name   string
+		run    func(*logrus.Logger)
+		report bool
+	}{
+		{
+			name:   "error",
+			run:    func(l *logrus.Logger) { l.Error("my log entry") },
+			report: true,
+		},
+		{
+			name:   "warning",
+			run:    func(l *logrus.Logger) { l.Warn("my log entry") },
+			report: false,
+		},
+		{
+			name:   "denied with errors.Is",
+			run:    func(l *logrus.Logger) { l.WithError(fmt.Errorf("call: %w", context.Canceled)).Error("my log entry") },
+			report: false,
+		},
+		{
+			name: "denied with errors.As",
+			run: func(l *logrus.Logger) {
+				l.WithError(fmt.Errorf("parse: %w", &validationError{"name"})).Error("my log entry")
+			},
+			report: false,
+		},
+		{
+			name:   "allowed warning",
+			run:    func(l *logrus.Logger) { l.WithError(fmt.Errorf("call: %w", errDependency)).Warn("my log entry") },
+			report: true,
+		},
+		{
+			name:   "forced",
+			run:    func(l *logrus.Logger) { l.WithField(KeyReportError, true).Info("my log entry") },
+			report: true,
+		},
+		{
+			name:   "suppressed",
+			run:    func(l *logrus.Logger) { l.WithField(KeyReportError, false).Error("my log entry") },
+			report: false,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var out bytes.Buffer
+
+			logger := logrus.New()
+			logger.Out = &out
+			logger.Formatter = NewFormatter(
+				WithoutReportErrors(ErrorIs(context.Canceled), ErrorAs((*validationError)(nil))),
+				WithReportErrors(ErrorIs(errDependency)),
+			)
+
+			tc.run(logger)
+
+			var got map[string]interface{}
+			require.NoError(t, json.Unmarshal(out.Bytes(), &got))
+
+			ctx, _ := got["context"].(map[string]interface{})
+			if !tc.report {
+				require.NotContains(t, ctx, "reportLocation")
+				require.NotContains(t, got, "@type")
+				return
+			}
+			require.Contains(t, ctx, "reportLocation")
+			data, _ := ctx["data"].(map[string]interface{})
+			require.NotContains(t, data, KeyReportError)
+			if got["severity"] != "ERROR" {
+				require.Equal(t, reportedErrorEventType, got["@type"])
+			}
+		})
+	}
+}
+
+func TestReportLevel(t *testing.T) {
+	var out bytes.Buffer
+
+	logger := logrus.New()
+	logger.Out = &out
+	logger.Formatter = NewFormatter(WithReportLevel(logrus.WarnLevel))
+
+	logger.WithError(errors.New("test error")).Warn("my log entry")
+
+	var got map[string]interface{}
+	require.NoError(t, json.Unmarshal(out.Bytes(), &got))
+
+	require.Equal(t, "WARNING", got["severity"])
+	require.Equal(t, "my log entry: test error", got["message"])
+	require.Equal(t, reportedErrorEventType, got["@type"])
+	require.Contains(t, got["context"], "reportLocation")
+}
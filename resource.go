@@ -0,0 +1,149 @@
+package stackdriver
+
+import (
+	"os"
+	"strings"
+)
+
+// Resource is the monitored resource an entry is associated with. More
+// information here: https://cloud.google.com/logging/docs/api/v2/resource-list
+type Resource struct {
+	Type   string            `json:"type"`
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// ResourceDetector detects the monitored resource the process runs on from
+// environment variables and the metadata server.
+type ResourceDetector struct {
+	// MetadataEndpoint overrides the metadata server base URL.
+	MetadataEndpoint string
+	// Getenv looks up environment variables. Defaults to os.Getenv.
+	Getenv func(string) string
+}
+
+// DetectResource detects the monitored resource using the default
+// ResourceDetector.
+func DetectResource() *Resource {
+	return (&ResourceDetector{}).Detect()
+}
+
+// Detect returns the monitored resource, one of cloud_function,
+// cloud_run_revision, cloud_run_job, gae_app, k8s_container or gce_instance,
+// falling back to global. Labels that can't be determined are left out.
+func (d *ResourceDetector) Detect() *Resource {
+	getenv := d.Getenv
+	if getenv == nil {
+		getenv = os.Getenv
+	}
+	r := &resourceLookup{
+		getenv:   getenv,
+		metadata: newMetadataClient(d.MetadataEndpoint),
+	}
+
+	switch {
+	case getenv("FUNCTION_TARGET") != "" || getenv("FUNCTION_NAME") != "":
+		name := getenv("K_SERVICE")
+		if name == "" {
+			name = getenv("FUNCTION_NAME")
+		}
+		return r.resource("cloud_function", map[string]string{
+			"project_id":    r.projectID(),
+			"function_name": name,
+			"region":        r.region(),
+		})
+	case getenv("K_SERVICE") != "" && getenv("K_REVISION") != "":
+		return r.resource("cloud_run_revision", map[string]string{
+			"project_id":         r.projectID(),
+			"service_name":       getenv("K_SERVICE"),
+			"revision_name":      getenv("K_REVISION"),
+			"configuration_name": getenv("K_CONFIGURATION"),
+			"location":           r.region(),
+		})
+	case getenv("CLOUD_RUN_JOB") != "":
+		return r.resource("cloud_run_job", map[string]string{
+			"project_id": r.projectID(),
+			"job_name":   getenv("CLOUD_RUN_JOB"),
+			"location":   r.region(),
+		})
+	case getenv("GAE_SERVICE") != "":
+		return r.resource("gae_app", map[string]string{
+			"project_id": r.projectID(),
+			"module_id":  getenv("GAE_SERVICE"),
+			"version_id": getenv("GAE_VERSION"),
+			"zone":       r.zone(),
+		})
+	case getenv("KUBERNETES_SERVICE_HOST") != "":
+		return r.resource("k8s_container", map[string]string{
+			"project_id":     r.projectID(),
+			"location":       r.metadataValue("instance/attributes/cluster-location"),
+			"cluster_name":   r.metadataValue("instance/attributes/cluster-name"),
+			"namespace_name": r.firstEnv("NAMESPACE", "POD_NAMESPACE"),
+			"pod_name":       r.firstEnv("POD_NAME", "HOSTNAME"),
+			"container_name": r.firstEnv("CONTAINER_NAME"),
+		})
+	}
+
+	if id := r.metadataValue("instance/id"); id != "" {
+		return r.resource("gce_instance", map[string]string{
+			"project_id":  r.projectID(),
+			"instance_id": id,
+			"zone":        r.zone(),
+		})
+	}
+
+	return &Resource{Type: "global"}
+}
+
+// resourceLookup resolves the values needed for one detection.
+type resourceLookup struct {
+	getenv   func(string) string
+	metadata *metadataClient
+}
+
+// resource drops the labels which couldn't be resolved.
+func (r *resourceLookup) resource(typ string, labels map[string]string) *Resource {
+	for k, v := range labels {
+		if v == "" {
+			delete(labels, k)
+		}
+	}
+	return &Resource{Type: typ, Labels: labels}
+}
+
+func (r *resourceLookup) firstEnv(keys ...string) string {
+	for _, key := range keys {
+		if v := r.getenv(key); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+func (r *resourceLookup) metadataValue(path string) string {
+	v, err := r.metadata.get(path)
+	if err != nil {
+		return ""
+	}
+	return v
+}
+
+func (r *resourceLookup) projectID() string {
+	if id := r.firstEnv("GOOGLE_CLOUD_PROJECT", "GCP_PROJECT"); id != "" {
+		return id
+	}
+	return r.metadataValue("project/project-id")
+}
+
+// region is returned by the metadata server as projects/[NUMBER]/regions/[REGION].
+func (r *resourceLookup) region() string {
+	return lastSegment(r.metadataValue("instance/region"))
+}
+
+// zone is returned by the metadata server as projects/[NUMBER]/zones/[ZONE].
+func (r *resourceLookup) zone() string {
+	return lastSegment(r.metadataValue("instance/zone"))
+}
+
+func lastSegment(s string) string {
+	return s[strings.LastIndex(s, "/")+1:]
+}
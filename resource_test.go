@@ -0,0 +1,149 @@
+package stackdriver
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+func fakeMetadataServer(t *testing.T, values map[string]string) string {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Metadata-Flavor") != "Google" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		v, ok := values[strings.TrimPrefix(r.URL.Path, "/computeMetadata/v1/")]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(v))
+	}))
+	t.Cleanup(srv.Close)
+	return srv.URL + "/computeMetadata/v1"
+}
+
+func TestDetectResource(t *testing.T) {
+	metadata := map[string]string{
+		"project/project-id":                   "my-project",
+		"instance/id":                          "1234",
+		"instance/zone":                        "projects/1/zones/europe-west1-b",
+		"instance/region":                      "projects/1/regions/europe-west1",
+		"instance/attributes/cluster-name":     "my-cluster",
+		"instance/attributes/cluster-location": "europe-west1",
+	}
+
+	for _, tc := range []struct {
+		name string
+		env  map[string]string
+		want *Resource
+	}{
+		{
+			name: "cloud run",
+			env:  map[string]string{"K_SERVICE": "svc", "K_REVISION": "svc-1", "K_CONFIGURATION": "svc"},
+			want: &Resource{Type: "cloud_run_revision", Labels: map[string]string{
+				"project_id":         "my-project",
+				"service_name":       "svc",
+				"revision_name":      "svc-1",
+				"configuration_name": "svc",
+				"location":           "europe-west1",
+			}},
+		},
+		{
+			name: "cloud run job",
+			env:  map[string]string{"CLOUD_RUN_JOB": "job", "GOOGLE_CLOUD_PROJECT": "other-project"},
+			want: &Resource{Type: "cloud_run_job", Labels: map[string]string{
+				"project_id": "other-project",
+				"job_name":   "job",
+				"location":   "europe-west1",
+			}},
+		},
+		{
+			name: "cloud function",
+			env:  map[string]string{"K_SERVICE": "fn", "K_REVISION": "fn-1", "FUNCTION_TARGET": "Handle"},
+			want: &Resource{Type: "cloud_function", Labels: map[string]string{
+				"project_id":    "my-project",
+				"function_name": "fn",
+				"region":        "europe-west1",
+			}},
+		},
+		{
+			name: "app engine",
+			env:  map[string]string{"GAE_SERVICE": "default", "GAE_VERSION": "v1"},
+			want: &Resource{Type: "gae_app", Labels: map[string]string{
+				"project_id": "my-project",
+				"module_id":  "default",
+				"version_id": "v1",
+				"zone":       "europe-west1-b",
+			}},
+		},
+		{
+			name: "kubernetes",
+			env: map[string]string{
+				"KUBERNETES_SERVICE_HOST": "10.0.0.1",
+				"POD_NAME":                "pod-abc",
+				"NAMESPACE":               "prod",
+				"CONTAINER_NAME":          "app",
+			},
+			want: &Resource{Type: "k8s_container", Labels: map[string]string{
+				"project_id":     "my-project",
+				"location":       "europe-west1",
+				"cluster_name":   "my-cluster",
+				"namespace_name": "prod",
+				"pod_name":       "pod-abc",
+				"container_name": "app",
+			}},
+		},
+		{
+			name: "compute engine",
+			env:  map[string]string{},
+			want: &Resource{Type: "gce_instance", Labels: map[string]string{
+				"project_id":  "my-project",
+				"instance_id": "1234",
+				"zone":        "europe-west1-b",
+			}},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			d := &ResourceDetector{
+				MetadataEndpoint: fakeMetadataServer(t, metadata),
+				Getenv:           func(k string) string { return tc.env[k] },
+			}
+			require.Equal(t, tc.want, d.Detect())
+		})
+	}
+}
+
+func TestDetectResourceGlobal(t *testing.T) {
+	d := &ResourceDetector{
+		MetadataEndpoint: fakeMetadataServer(t, nil),
+		Getenv:           func(string) string { return "" },
+	}
+	require.Equal(t, &Resource{Type: "global"}, d.Detect())
+}
+
+func TestResource(t *testing.T) {
+	var out bytes.Buffer
+
+	logger := logrus.New()
+	logger.Out = &out
+	logger.Formatter = NewFormatter(
+		WithResource(&Resource{Type: "gce_instance", Labels: map[string]string{"instance_id": "1234"}}),
+	)
+
+	logger.Info("my log entry")
+
+	var got map[string]interface{}
+	json.Unmarshal(out.Bytes(), &got)
+
+	require.Equal(t, map[string]interface{}{
+		"type":   "gce_instance",
+		"labels": map[string]interface{}{"instance_id": "1234"},
+	}, got["resource"])
+}
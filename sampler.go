@@ -0,0 +1,319 @@
+package stackdriver
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// maxSamplerKeys bounds the number of token buckets a Sampler keeps.
+const maxSamplerKeys = 10000
+
+// Sampler decides which entries below ERROR severity are written, to keep
+// the volume of noisy entries down. Entries are first sampled at the rate
+// of their level, then limited by a token bucket per message and source
+// location. ERROR and more severe entries are always written, and so are
+// all entries of a sampled trace.
+//
+// The number of entries suppressed for each message and source location is
+// reported in a WARNING summary entry written along with the first entry
+// after each summary interval, or by Flush. Entries suppressed just before
+// logging goes quiet are only reported by Flush: call it from a ticker to
+// report them, and before the program exits; it is also run by the logrus
+// exit handlers before Fatal exits.
+//
+// A Sampler is meant to live as long as the process: it stays registered
+// with the logrus exit handlers.
+type Sampler struct {
+	perSecond       float64
+	burst           float64
+	traceRate       float64
+	summaryInterval time.Duration
+	now             func() time.Time
+
+	mu          sync.Mutex
+	rates       map[logrus.Level]float64
+	buckets     map[samplerKey]*tokenBucket
+	suppressed  map[samplerKey]int64
+	lastSummary time.Time
+	formatter   *Formatter
+	sink        sink
+}
+
+type samplerKey struct {
+	message  string
+	location string
+	severity severity
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// SamplerOption lets you configure the Sampler.
+type SamplerOption func(*Sampler)
+
+// WithSamplingRate sets the fraction of entries at level l which are kept,
+// between 0 and 1. Defaults to 1. It has no effect on ERROR and more
+// severe levels.
+func WithSamplingRate(l logrus.Level, rate float64) SamplerOption {
+	return func(s *Sampler) {
+		s.rates[l] = rate
+	}
+}
+
+// WithSamplingLimit limits the entries written for each message and source
+// location to perSecond, with bursts of up to burst entries. Zero perSecond
+// disables the limit.
+func WithSamplingLimit(perSecond float64, burst int) SamplerOption {
+	return func(s *Sampler) {
+		s.perSecond = perSecond
+		s.burst = float64(burst)
+	}
+}
+
+// WithSamplingTraceRate sets the fraction of traces for which all entries
+// are kept, between 0 and 1. The trace is found like in the formatted
+// entry, including field key aliases and the TraceExtractor. Entries with
+// a KeyTraceSampled field set to true are always kept.
+func WithSamplingTraceRate(rate float64) SamplerOption {
+	return func(s *Sampler) {
+		s.traceRate = rate
+	}
+}
+
+// WithSamplingSummaryInterval sets the least time between summaries of the
+// suppressed entries. Defaults to a minute.
+func WithSamplingSummaryInterval(d time.Duration) SamplerOption {
+	return func(s *Sampler) {
+		s.summaryInterval = d
+	}
+}
+
+// NewSampler returns a new Sampler.
+func NewSampler(options ...SamplerOption) *Sampler {
+	s := &Sampler{
+		rates:           map[logrus.Level]float64{},
+		summaryInterval: time.Minute,
+		now:             time.Now,
+		buckets:         map[samplerKey]*tokenBucket{},
+		suppressed:      map[samplerKey]int64{},
+	}
+	for _, option := range options {
+		option(s)
+	}
+	s.lastSummary = s.now()
+	flushAtExit(s)
+	return s
+}
+
+// Flush writes the summary of the entries suppressed since the last one,
+// if any, where the last sampled entry was written. It is safe to call
+// while entries are logged.
+func (s *Sampler) Flush() {
+	s.mu.Lock()
+	if len(s.suppressed) == 0 || s.sink == nil {
+		s.mu.Unlock()
+		return
+	}
+	now := s.now()
+	s.lastSummary = now
+	summary := s.summary(nil, now)
+	f, w := s.formatter, s.sink
+	s.mu.Unlock()
+
+	w.writeEntries([]Entry{f.ToEntry(summary)})
+}
+
+// WithSampler lets you configure a Sampler deciding which entries are
+// written by Format.
+func WithSampler(s *Sampler) Option {
+	return func(f *Formatter) {
+		f.sampler = s
+	}
+}
+
+// sample reports whether e, with trace as its trace ID, formatted by f and
+// written to w, is kept, and returns a summary entry when one is due.
+func (s *Sampler) sample(f *Formatter, w sink, e *logrus.Entry, trace string) (bool, *logrus.Entry) {
+	always := e.Level <= logrus.ErrorLevel || s.traceKept(e, trace)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Flush writes where the entries went.
+	s.formatter = f
+	if w != nil {
+		s.sink = w
+	}
+
+	keep := always
+	if !always {
+		rate, ok := s.rates[e.Level]
+		keep = !ok || rand.Float64() < rate
+	}
+
+	now := s.now()
+	key := samplerKey{
+		message:  e.Message,
+		location: entryLocation(e),
+		severity: levelsToSeverity[e.Level],
+	}
+	if keep && !always {
+		keep = s.take(key, now)
+	}
+	if !keep {
+		s.suppressed[key]++
+	}
+
+	if len(s.suppressed) == 0 || now.Sub(s.lastSummary) < s.summaryInterval {
+		return keep, nil
+	}
+	s.lastSummary = now
+	return keep, s.summary(e.Logger, now)
+}
+
+// traceKept reports whether e belongs to a sampled trace.
+func (s *Sampler) traceKept(e *logrus.Entry, trace string) bool {
+	if sampled, ok := e.Data[KeyTraceSampled].(bool); ok && sampled {
+		return true
+	}
+	if trace == "" || s.traceRate <= 0 {
+		return false
+	}
+	// Hashing the trace makes the decision the same for all its entries.
+	h := fnv.New64a()
+	h.Write([]byte(trace))
+	return float64(h.Sum64())/math.MaxUint64 < s.traceRate
+}
+
+// sampledTrace returns the trace ID of e found like ToEntry does, from
+// KeyTrace, its aliases or the context, without computing the entry.
+func (f *Formatter) sampledTrace(e *logrus.Entry) string {
+	var trace string
+	setTrace := func(val interface{}) bool {
+		str, ok := traceID(val)
+		if !ok {
+			return false
+		}
+		_, id, err := parseTrace(str)
+		if err != nil {
+			return false
+		}
+		trace = id
+		return true
+	}
+	if !f.promote(e, nil, KeyTrace, setTrace) && f.TraceExtractor != nil && e.Context != nil {
+		setTrace(f.TraceExtractor(e.Context))
+	}
+	return trace
+}
+
+// take takes a token from the bucket of key. It must be called with s.mu
+// held.
+func (s *Sampler) take(key samplerKey, now time.Time) bool {
+	if s.perSecond <= 0 {
+		return true
+	}
+
+	b, ok := s.buckets[key]
+	if !ok {
+		if len(s.buckets) >= maxSamplerKeys {
+			s.buckets = map[samplerKey]*tokenBucket{}
+		}
+		b = &tokenBucket{tokens: s.burst, last: now}
+		s.buckets[key] = b
+	}
+
+	b.tokens = math.Min(s.burst, b.tokens+now.Sub(b.last).Seconds()*s.perSecond)
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// summary returns an entry reporting the suppressed entries and resets the
+// counts. It must be called with s.mu held.
+func (s *Sampler) summary(logger *logrus.Logger, now time.Time) *logrus.Entry {
+	keys := make([]samplerKey, 0, len(s.suppressed))
+	var n int64
+	for key, c := range s.suppressed {
+		keys = append(keys, key)
+		n += c
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if s.suppressed[keys[i]] != s.suppressed[keys[j]] {
+			return s.suppressed[keys[i]] > s.suppressed[keys[j]]
+		}
+		return keys[i].message < keys[j].message
+	})
+
+	counts := make([]interface{}, 0, len(keys))
+	for _, key := range keys {
+		count := map[string]interface{}{
+			"message":  key.message,
+			"severity": string(key.severity),
+			"count":    s.suppressed[key],
+		}
+		if key.location != "" {
+			count["sourceLocation"] = key.location
+		}
+		counts = append(counts, count)
+	}
+	s.suppressed = map[samplerKey]int64{}
+
+	return &logrus.Entry{
+		Logger:  logger,
+		Time:    now,
+		Level:   logrus.WarnLevel,
+		Message: fmt.Sprintf("suppressed %d log entries", n),
+		Data: logrus.Fields{
+			"suppressedEntries": counts,
+		},
+	}
+}
+
+// entryLocation returns where e was logged, as far as it is known without
+// walking the stack.
+func entryLocation(e *logrus.Entry) string {
+	if loc, ok := e.Data[KeySourceLocation].(*ReportLocation); ok {
+		return fmt.Sprintf("%s:%d", loc.FilePath, loc.LineNumber)
+	}
+	if e.HasCaller() {
+		return fmt.Sprintf("%s:%d", e.Caller.File, e.Caller.Line)
+	}
+	return ""
+}
+
+// Rates returns the sampling rates by level.
+func (s *Sampler) Rates() map[logrus.Level]float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rates := make(map[logrus.Level]float64, len(s.rates))
+	for l, rate := range s.rates {
+		rates[l] = rate
+	}
+	return rates
+}
+
+// SetRates replaces the sampling rates by level, see WithSamplingRate.
+func (s *Sampler) SetRates(rates map[logrus.Level]float64) {
+	copied := make(map[logrus.Level]float64, len(rates))
+	for l, rate := range rates {
+		copied[l] = rate
+	}
+
+	s.mu.Lock()
+	s.rates = copied
+	s.mu.Unlock()
+}
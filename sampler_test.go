@@ -0,0 +1,173 @@
+package stackdriver
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+func decodeEntries(t *testing.T, out *bytes.Buffer) []map[string]interface{} {
+	var entries []map[string]interface{}
+	dec := json.NewDecoder(out)
+	for dec.More() {
+		var entry map[string]interface{}
+		require.NoError(t, dec.Decode(&entry))
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+func TestSampler(t *testing.T) {
+	var out bytes.Buffer
+
+	now := time.Date(2020, 10, 12, 14, 26, 0, 0, time.UTC)
+	sampler := NewSampler(
+		WithSamplingRate(logrus.DebugLevel, 0),
+		WithSamplingLimit(1, 2),
+		WithSamplingTraceRate(0),
+		WithSamplingSummaryInterval(time.Minute),
+	)
+	sampler.now = func() time.Time { return now }
+	sampler.lastSummary = now
+
+	logger := logrus.New()
+	logger.Out = &out
+	logger.Level = logrus.DebugLevel
+	logger.Formatter = NewFormatter(WithSampler(sampler))
+
+	logger.Debug("debug entry")
+	for i := 0; i < 5; i++ {
+		logger.Info("info entry")
+	}
+	logger.WithField(KeyTraceSampled, true).Debug("sampled trace")
+	logger.Error("error entry")
+
+	var messages []interface{}
+	for _, entry := range decodeEntries(t, &out) {
+		messages = append(messages, entry["message"])
+	}
+	require.Equal(t, []interface{}{"info entry", "info entry", "sampled trace", "error entry"}, messages)
+
+	// The bucket refills and the summary is due.
+	now = now.Add(time.Minute)
+	logger.Info("info entry")
+
+	entries := decodeEntries(t, &out)
+	require.Len(t, entries, 2)
+	require.Equal(t, "WARNING", entries[0]["severity"])
+	require.Equal(t, "suppressed 4 log entries", entries[0]["message"])
+	require.Equal(t, []interface{}{
+		map[string]interface{}{"message": "info entry", "severity": "INFO", "count": 3.0},
+		map[string]interface{}{"message": "debug entry", "severity": "DEBUG", "count": 1.0},
+	}, entries[0]["context"].(map[string]interface{})["data"].(map[string]interface{})["suppressedEntries"])
+	require.Equal(t, "info entry", entries[1]["message"])
+}
+
+func TestSamplerTraceRate(t *testing.T) {
+	var out bytes.Buffer
+
+	logger := logrus.New()
+	logger.Out = &out
+	logger.Level = logrus.DebugLevel
+	logger.Formatter = NewFormatter(WithSampler(NewSampler(
+		WithSamplingRate(logrus.DebugLevel, 0),
+		WithSamplingRate(logrus.InfoLevel, 0),
+		WithSamplingTraceRate(1),
+	)))
+
+	traced := logger.WithField(KeyTrace, "105445aa7843bc8bf206b12000100000")
+	traced.Debug("debug entry")
+	traced.Info("info entry")
+	logger.Info("untraced entry")
+
+	entries := decodeEntries(t, &out)
+	require.Len(t, entries, 2)
+	require.Equal(t, "debug entry", entries[0]["message"])
+	require.Equal(t, "info entry", entries[1]["message"])
+}
+
+func TestSamplerTraceRateAliases(t *testing.T) {
+	var out bytes.Buffer
+
+	logger := logrus.New()
+	logger.Out = &out
+	logger.Formatter = NewFormatter(
+		WithFieldKeys(KeyTrace, "trace_id"),
+		WithTraceExtractor(func(ctx context.Context) string {
+			trace, _ := ctx.Value(traceContextKey{}).(string)
+			return trace
+		}),
+		WithSampler(NewSampler(
+			WithSamplingRate(logrus.InfoLevel, 0),
+			WithSamplingTraceRate(1),
+		)),
+	)
+
+	logger.WithField("trace_id", "105445aa7843bc8bf206b12000100000").Info("aliased entry")
+	ctx := context.WithValue(context.Background(), traceContextKey{}, "projects/my-project/traces/105445aa7843bc8bf206b12000100000")
+	logger.WithContext(ctx).Info("context entry")
+	logger.Info("untraced entry")
+
+	entries := decodeEntries(t, &out)
+	require.Len(t, entries, 2)
+	require.Equal(t, "aliased entry", entries[0]["message"])
+	require.Equal(t, "context entry", entries[1]["message"])
+}
+
+func TestSamplerFlush(t *testing.T) {
+	var out bytes.Buffer
+
+	sampler := NewSampler(WithSamplingRate(logrus.InfoLevel, 0))
+
+	logger := logrus.New()
+	logger.Out = &out
+	logger.Formatter = NewFormatter(WithSampler(sampler))
+
+	for i := 0; i < 3; i++ {
+		logger.Info("info entry")
+	}
+	require.Zero(t, out.Len())
+
+	sampler.Flush()
+
+	entries := decodeEntries(t, &out)
+	require.Len(t, entries, 1)
+	require.Equal(t, "WARNING", entries[0]["severity"])
+	require.Equal(t, "suppressed 3 log entries", entries[0]["message"])
+
+	// Nothing is left to report.
+	sampler.Flush()
+	require.Zero(t, out.Len())
+}
+
+func TestSamplerFlushConcurrent(t *testing.T) {
+	var out bytes.Buffer
+
+	sampler := NewSampler(WithSamplingRate(logrus.InfoLevel, 0.5))
+
+	logger := logrus.New()
+	logger.Out = &out
+	logger.Formatter = NewFormatter(WithSampler(sampler))
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			logger.Info("info entry")
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			sampler.Flush()
+		}
+	}()
+	wg.Wait()
+}
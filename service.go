@@ -0,0 +1,87 @@
+package stackdriver
+
+import (
+	"context"
+	"path"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+type packageService struct {
+	pkg string
+	ServiceContext
+}
+
+// WithServiceExtractor lets you configure how the service of an entry is
+// found in its context, overriding the service of the Formatter.
+func WithServiceExtractor(fn func(context.Context) *ServiceContext) Option {
+	return func(f *Formatter) {
+		f.ServiceExtractor = fn
+	}
+}
+
+// WithPackageService attributes the entries located in pkg, or the packages
+// below it, to service and version rather than the service of the
+// Formatter. The location is the one reported to Error Reporting, so it
+// only applies to reported entries or entries with a KeySourceLocation
+// field. The longest matching package wins.
+func WithPackageService(pkg, service, version string) Option {
+	return func(f *Formatter) {
+		f.packageServices = append(f.packageServices, packageService{
+			pkg:            strings.TrimSuffix(pkg, "/"),
+			ServiceContext: ServiceContext{Service: service, Version: version},
+		})
+	}
+}
+
+// serviceContext returns the service of e, which is the one of the
+// KeyService and KeyServiceVersion fields, of its context, of the package
+// at location, or of the Formatter, in that order.
+func (f *Formatter) serviceContext(e *logrus.Entry, data logrus.Fields, location *ReportLocation) *ServiceContext {
+	sc := ServiceContext{Service: f.Service, Version: f.Version}
+
+	if location != nil {
+		if ps, ok := f.packageService(path.Dir(location.FilePath)); ok {
+			sc = ps
+		}
+	}
+
+	if f.ServiceExtractor != nil && e.Context != nil {
+		if s := f.ServiceExtractor(e.Context); s != nil {
+			sc = *s
+		}
+	}
+
+	f.promote(e, data, KeyService, func(val interface{}) bool {
+		str, ok := val.(string)
+		if ok {
+			sc.Service = str
+		}
+		return ok
+	})
+	f.promote(e, data, KeyServiceVersion, func(val interface{}) bool {
+		str, ok := val.(string)
+		if ok {
+			sc.Version = str
+		}
+		return ok
+	})
+
+	return &sc
+}
+
+// packageService returns the service registered for the package pkg.
+func (f *Formatter) packageService(pkg string) (ServiceContext, bool) {
+	var match packageService
+	var found bool
+	for _, ps := range f.packageServices {
+		if pkg != ps.pkg && !strings.HasPrefix(pkg, ps.pkg+"/") {
+			continue
+		}
+		if !found || len(ps.pkg) > len(match.pkg) {
+			match, found = ps, true
+		}
+	}
+	return match.ServiceContext, found
+}
@@ -0,0 +1,99 @@
+package stackdriver
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"path"
+	"testing"
+
+	"github.com/go-stack/stack"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+type serviceContextKey struct{}
+
+func TestServiceContext(t *testing.T) {
+	// The package as found by the stack walk.
+	pkg := path.Dir(callLocation(stack.Caller(0)).FilePath)
+
+	ctx := context.WithValue(context.Background(), serviceContextKey{}, &ServiceContext{Service: "context", Version: "2"})
+
+	for _, tc := range []struct {
+		name  string
+		entry func(*logrus.Entry)
+		want  interface{}
+	}{
+		{
+			name:  "formatter",
+			entry: func(e *logrus.Entry) { e.Info("my log entry") },
+			want:  map[string]interface{}{"service": "test", "version": "0.1"},
+		},
+		{
+			name:  "package",
+			entry: func(e *logrus.Entry) { e.Error("my log entry") },
+			want:  map[string]interface{}{"service": "billing", "version": "1"},
+		},
+		{
+			name:  "context",
+			entry: func(e *logrus.Entry) { e.WithContext(ctx).Error("my log entry") },
+			want:  map[string]interface{}{"service": "context", "version": "2"},
+		},
+		{
+			name: "fields",
+			entry: func(e *logrus.Entry) {
+				e.WithContext(ctx).WithFields(logrus.Fields{
+					KeyService:        "field",
+					KeyServiceVersion: "3",
+				}).Error("my log entry")
+			},
+			want: map[string]interface{}{"service": "field", "version": "3"},
+		},
+		{
+			name:  "field without version",
+			entry: func(e *logrus.Entry) { e.WithField(KeyService, "field").Info("my log entry") },
+			want:  map[string]interface{}{"service": "field", "version": "0.1"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var out bytes.Buffer
+
+			logger := logrus.New()
+			logger.Out = &out
+			logger.Formatter = NewFormatter(
+				WithService("test"),
+				WithVersion("0.1"),
+				WithPackageService(path.Dir(pkg), "other", "0"),
+				WithPackageService(pkg, "billing", "1"),
+				WithPackageService(pkg+"/internal", "internal", "0"),
+				WithServiceExtractor(func(ctx context.Context) *ServiceContext {
+					sc, _ := ctx.Value(serviceContextKey{}).(*ServiceContext)
+					return sc
+				}),
+			)
+
+			tc.entry(logrus.NewEntry(logger))
+
+			var got map[string]interface{}
+			require.NoError(t, json.Unmarshal(out.Bytes(), &got))
+			require.Equal(t, tc.want, got["serviceContext"])
+			require.NotContains(t, got["context"], "data")
+		})
+	}
+}
+
+func TestServiceFieldNotPromoted(t *testing.T) {
+	var out bytes.Buffer
+
+	logger := logrus.New()
+	logger.Out = &out
+	logger.Formatter = NewFormatter(WithService("api"))
+
+	logger.WithField("service", "stripe").Error("my log entry")
+
+	var got map[string]interface{}
+	require.NoError(t, json.Unmarshal(out.Bytes(), &got))
+	require.Equal(t, map[string]interface{}{"service": "api"}, got["serviceContext"])
+	require.Equal(t, map[string]interface{}{"service": "stripe"}, got["context"].(map[string]interface{})["data"])
+}
@@ -0,0 +1,55 @@
+package stackdriver
+
+import (
+	"context"
+
+	"github.com/sirupsen/logrus"
+)
+
+// sink writes entries built outside of the logging calls, such as the
+// summaries of a Sampler or the repeats of a Deduplicator flushed at
+// shutdown, to where the logging calls write, holding the same lock.
+type sink interface {
+	writeEntries(entries []Entry)
+}
+
+// builtEntryKey is the context key of an Entry logged by loggerSink, which
+// Format writes as is.
+type builtEntryKey struct{}
+
+// builtEntry returns the Entry carried by e, if any.
+func builtEntry(e *logrus.Entry) (Entry, bool) {
+	if e.Context == nil {
+		return Entry{}, false
+	}
+	ee, ok := e.Context.Value(builtEntryKey{}).(Entry)
+	return ee, ok
+}
+
+// loggerSink writes entries by logging them with a logrus.Logger, as only
+// the logger can take its lock.
+type loggerSink struct {
+	logger *logrus.Logger
+}
+
+func (s loggerSink) writeEntries(entries []Entry) {
+	for _, ee := range entries {
+		ctx := context.WithValue(context.Background(), builtEntryKey{}, ee)
+		s.logger.WithContext(ctx).Log(severityLevel(ee.Severity), ee.Message)
+	}
+}
+
+// severityLevel returns the logrus level of s, for the level filter and
+// hooks of the logger. ALERT maps to logrus.FatalLevel, as logging at
+// logrus.PanicLevel panics.
+func severityLevel(s severity) logrus.Level {
+	for l, ls := range levelsToSeverity {
+		if ls == s && l != logrus.PanicLevel {
+			return l
+		}
+	}
+	if s == severityAlert {
+		return logrus.FatalLevel
+	}
+	return logrus.InfoLevel
+}
@@ -0,0 +1,261 @@
+package stackdriver
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Levels above slog.LevelError, mapped to the CRITICAL and ALERT severities
+// used for logrus' Fatal and Panic levels.
+const (
+	SlogLevelCritical = slog.Level(12)
+	SlogLevelAlert    = slog.Level(16)
+)
+
+// slogLevel maps a slog level onto the logrus level with the same severity.
+func slogLevel(l slog.Level) logrus.Level {
+	switch {
+	case l >= SlogLevelAlert:
+		return logrus.PanicLevel
+	case l >= SlogLevelCritical:
+		return logrus.FatalLevel
+	case l >= slog.LevelError:
+		return logrus.ErrorLevel
+	case l >= slog.LevelWarn:
+		return logrus.WarnLevel
+	case l >= slog.LevelInfo:
+		return logrus.InfoLevel
+	default:
+		return logrus.DebugLevel
+	}
+}
+
+// SlogHandler is a slog.Handler producing the same entries as the Formatter.
+// Attributes are mapped like logrus fields, so the known keys and
+// logrus.ErrorKey are recognised at the top level, and groups become nested
+// objects in the entry data.
+type SlogHandler struct {
+	formatter *Formatter
+	level     slog.Leveler
+
+	mu  *sync.Mutex
+	out io.Writer
+
+	// data holds the attributes added with WithAttrs, pre-serialised except
+	// for the maps of the open groups.
+	data   logrus.Fields
+	groups []string
+}
+
+// SlogOption lets you configure the SlogHandler.
+type SlogOption func(*SlogHandler)
+
+// WithSlogLevel sets the minimum level of entries to write. Defaults to
+// slog.LevelInfo.
+func WithSlogLevel(l slog.Leveler) SlogOption {
+	return func(h *SlogHandler) {
+		h.level = l
+	}
+}
+
+// NewSlogHandler returns a new SlogHandler writing entries formatted by f to out.
+func NewSlogHandler(out io.Writer, f *Formatter, options ...SlogOption) *SlogHandler {
+	h := &SlogHandler{
+		formatter: f,
+		level:     slog.LevelInfo,
+		mu:        &sync.Mutex{},
+		out:       out,
+		data:      logrus.Fields{},
+	}
+	for _, option := range options {
+		option(h)
+	}
+	return h
+}
+
+// Enabled reports whether entries at level l are written.
+func (h *SlogHandler) Enabled(_ context.Context, l slog.Level) bool {
+	return l >= h.level.Level()
+}
+
+// Handle formats and writes r.
+func (h *SlogHandler) Handle(ctx context.Context, r slog.Record) error {
+	data := cloneFields(h.data, h.groups)
+	r.Attrs(func(a slog.Attr) bool {
+		addAttr(data, h.groups, a, nil)
+		return true
+	})
+
+	e := &logrus.Entry{
+		Data:    data,
+		Time:    r.Time,
+		Level:   slogLevel(r.Level),
+		Message: r.Message,
+		Context: ctx,
+	}
+
+	out, keep, forced, err := h.formatter.admit(h, e)
+	if err != nil {
+		return err
+	}
+	if keep {
+		// ToEntry must be called from here, errorOrigin skips a fixed
+		// number of frames before walking past the log/slog ones.
+		if out, err = h.formatter.emit(out, h, e, h.formatter.ToEntry(e), forced); err != nil {
+			return err
+		}
+	}
+	if len(out) == 0 {
+		return nil
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, err = h.out.Write(out)
+	return err
+}
+
+// writeEntries writes entries built outside of Handle, see sink.
+func (h *SlogHandler) writeEntries(entries []Entry) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, ee := range entries {
+		if b, err := h.formatter.render(ee); err == nil {
+			h.out.Write(b)
+		}
+	}
+}
+
+// WithAttrs returns a handler adding attrs to all entries.
+func (h *SlogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+	h2 := *h
+	h2.data = cloneFields(h.data, h.groups)
+	for _, a := range attrs {
+		addAttr(h2.data, h.groups, a, h.formatter)
+	}
+	return &h2
+}
+
+// WithGroup returns a handler nesting all following attributes under name.
+func (h *SlogHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	h2 := *h
+	h2.groups = append(h.groups[:len(h.groups):len(h.groups)], name)
+	return &h2
+}
+
+// cloneFields copies data and the maps of the open groups, which are the
+// only ones modified when adding attributes.
+func cloneFields(data logrus.Fields, groups []string) logrus.Fields {
+	clone := make(logrus.Fields, len(data))
+	for k, v := range data {
+		clone[k] = v
+	}
+
+	m := map[string]interface{}(clone)
+	for _, g := range groups {
+		group, ok := m[g].(map[string]interface{})
+		if !ok {
+			return clone
+		}
+		copied := make(map[string]interface{}, len(group))
+		for k, v := range group {
+			copied[k] = v
+		}
+		m[g] = copied
+		m = copied
+	}
+	return clone
+}
+
+// addAttr adds a to the innermost open group of data, creating the groups
+// as needed. With a Formatter to serialise, values other than the known keys
+// are stored as the JSON it would write.
+func addAttr(data logrus.Fields, groups []string, a slog.Attr, serialise *Formatter) {
+	a.Value = a.Value.Resolve()
+	if a.Equal(slog.Attr{}) {
+		return
+	}
+	if a.Value.Kind() == slog.KindGroup {
+		if len(a.Value.Group()) == 0 {
+			return
+		}
+		if a.Key == "" {
+			for _, ga := range a.Value.Group() {
+				addAttr(data, groups, ga, serialise)
+			}
+			return
+		}
+	}
+
+	m := map[string]interface{}(data)
+	for _, g := range groups {
+		group, ok := m[g].(map[string]interface{})
+		if !ok {
+			group = map[string]interface{}{}
+			m[g] = group
+		}
+		m = group
+	}
+
+	// Known keys and errors are left for ToEntry to handle.
+	_, isErr := a.Value.Any().(error)
+	known := isKnownKey(a.Key) || serialise != nil && serialise.isFieldKey(a.Key)
+	if len(groups) == 0 && (known || isErr) {
+		m[a.Key] = a.Value.Any()
+		return
+	}
+
+	// Lazy values are left to be computed when the entry is written.
+	v := slogValue(a.Value)
+	if _, lazy := v.(lazyValue); serialise != nil && !lazy {
+		if b, err := json.Marshal(serialise.encodeValue(v)); err == nil {
+			v = json.RawMessage(b)
+		}
+	}
+	m[a.Key] = v
+}
+
+// isKnownKey reports whether ToEntry needs the value of key as is.
+func isKnownKey(key string) bool {
+	switch key {
+	case KeyTrace, KeySpanID, KeyHTTPRequest, KeyLogID, KeySourceLocation,
+		KeyUser, KeyErrorGroup, KeyReportError, KeyLabels, KeyTraceSampled,
+		KeyTraceProject, KeyService, KeyServiceVersion, logrus.ErrorKey:
+		return true
+	}
+	return false
+}
+
+// slogValue converts v to the value of a logrus field, groups becoming
+// maps. Values such as errors are left for Formatter.encodeValue, so they
+// are written like in logrus fields.
+func slogValue(v slog.Value) interface{} {
+	v = v.Resolve()
+	switch v.Kind() {
+	case slog.KindGroup:
+		m := map[string]interface{}{}
+		for _, a := range v.Group() {
+			a.Value = a.Value.Resolve()
+			if a.Key == "" && a.Value.Kind() == slog.KindGroup {
+				for _, ga := range a.Value.Group() {
+					m[ga.Key] = slogValue(ga.Value)
+				}
+				continue
+			}
+			m[a.Key] = slogValue(a.Value)
+		}
+		return m
+	}
+	return v.Any()
+}
@@ -0,0 +1,135 @@
+package stackdriver
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSlogHandler(t *testing.T) {
+	var out bytes.Buffer
+
+	logger := slog.New(NewSlogHandler(&out, NewFormatter(
+		WithService("test"),
+		WithVersion("0.1"),
+		WithProjectID("my-project"),
+	)))
+
+	logger.
+		With("foo", "bar", KeyTrace, "105445aa7843bc8bf206b12000100000").
+		WithGroup("request").
+		With("id", 1).
+		Error("my log entry",
+			"latency", 1500*time.Millisecond,
+			slog.Group("user", "name", "alice"),
+		)
+
+	var got map[string]interface{}
+	require.NoError(t, json.Unmarshal(out.Bytes(), &got))
+
+	require.Equal(t, "ERROR", got["severity"])
+	require.Equal(t, "my log entry", got["message"])
+	require.Equal(t, "105445aa7843bc8bf206b12000100000", got["trace_id"])
+	require.Equal(t, "projects/my-project/traces/105445aa7843bc8bf206b12000100000", got["logging.googleapis.com/trace"])
+	require.Equal(t, map[string]interface{}{"service": "test", "version": "0.1"}, got["serviceContext"])
+
+	ctx := got["context"].(map[string]interface{})
+	require.Equal(t, map[string]interface{}{
+		"foo": "bar",
+		"request": map[string]interface{}{
+			"id":      1.0,
+			"latency": "1.5s",
+			"user":    map[string]interface{}{"name": "alice"},
+		},
+	}, ctx["data"])
+	require.Equal(t, "TestSlogHandler", ctx["reportLocation"].(map[string]interface{})["functionName"])
+}
+
+func TestSlogHandlerMatchesLogrus(t *testing.T) {
+	var slogOut, logrusOut bytes.Buffer
+
+	formatter := NewFormatter(WithService("test"), WithVersion("0.1"))
+
+	slog.New(NewSlogHandler(&slogOut, formatter)).
+		Warn("my log entry", "foo", "bar", logrus.ErrorKey, errors.New("test error"), KeySpanID, "000000000000004a")
+
+	logger := logrus.New()
+	logger.Out = &logrusOut
+	logger.Formatter = formatter
+	logger.
+		WithFields(logrus.Fields{"foo": "bar", KeySpanID: "000000000000004a"}).
+		WithError(errors.New("test error")).
+		Warn("my log entry")
+
+	require.JSONEq(t, logrusOut.String(), slogOut.String())
+}
+
+func TestSlogHandlerLevel(t *testing.T) {
+	var out bytes.Buffer
+
+	logger := slog.New(NewSlogHandler(&out, NewFormatter(), WithSlogLevel(slog.LevelWarn)))
+	logger.Info("dropped")
+	require.Zero(t, out.Len())
+
+	for level, want := range map[slog.Level]string{
+		slog.LevelWarn:    "WARNING",
+		slog.LevelError:   "ERROR",
+		SlogLevelCritical: "CRITICAL",
+		SlogLevelAlert:    "ALERT",
+	} {
+		out.Reset()
+		logger.Log(context.Background(), level, "my log entry")
+
+		var got map[string]interface{}
+		require.NoError(t, json.Unmarshal(out.Bytes(), &got))
+		require.Equal(t, want, got["severity"])
+	}
+}
+
+func TestSlogHandlerPipeline(t *testing.T) {
+	var out bytes.Buffer
+
+	metrics := &Metrics{}
+	logger := slog.New(NewSlogHandler(&out, NewFormatter(
+		WithMetrics(metrics),
+		WithSampler(NewSampler(WithSamplingRate(logrus.InfoLevel, 0))),
+		WithDeduplicator(NewDeduplicator(time.Hour)),
+	)))
+
+	logger.Info("sampled entry")
+	for i := 0; i < 2; i++ {
+		logger.Error("error entry")
+	}
+
+	require.Equal(t, []string{"error entry"}, messages(t, strings.Split(strings.TrimSpace(out.String()), "\n")))
+	snapshot := metrics.Snapshot()
+	require.Equal(t, int64(1), snapshot["entries"].(map[string]int64)["ERROR"])
+	require.Equal(t, int64(out.Len()), snapshot["bytes"])
+	require.Equal(t, int64(1), snapshot["sampledEntries"])
+	require.Equal(t, int64(1), snapshot["deduplicatedEntries"])
+}
+
+func TestSlogHandlerGroupErrors(t *testing.T) {
+	var out bytes.Buffer
+
+	err := fmt.Errorf("wrap: %w", errors.New("inner"))
+	logger := slog.New(NewSlogHandler(&out, NewFormatter(WithRichErrors())))
+	logger.WithGroup("g").With("e1", err).Info("my log entry", "e2", err, slog.Group("h", "e3", err))
+
+	var got map[string]interface{}
+	require.NoError(t, json.Unmarshal(out.Bytes(), &got))
+
+	group := got["context"].(map[string]interface{})["data"].(map[string]interface{})["g"].(map[string]interface{})
+	for _, e := range []interface{}{group["e1"], group["e2"], group["h"].(map[string]interface{})["e3"]} {
+		require.Equal(t, "wrap: inner", e.(map[string]interface{})["message"])
+	}
+}
@@ -2,6 +2,7 @@ package stackdriver
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"reflect"
 	"testing"
@@ -21,7 +22,7 @@ func TestTrace(t *testing.T) {
 		WithVersion("0.1"),
 	)
 
-	logger.WithField(KeyTrace, "my-trace").WithField(KeySpanID, "my-span").Info("my log entry")
+	logger.WithField(KeyTrace, "105445aa7843bc8bf206b12000100000").WithField(KeySpanID, "000000000000004a").Info("my log entry")
 
 	var got map[string]interface{}
 	json.Unmarshal(out.Bytes(), &got)
@@ -34,8 +35,8 @@ func TestTrace(t *testing.T) {
 			"service": "test",
 			"version": "0.1",
 		},
-		"logging.googleapis.com/trace":  "my-trace",
-		"logging.googleapis.com/spanId": "my-span",
+		"logging.googleapis.com/trace":  "105445aa7843bc8bf206b12000100000",
+		"logging.googleapis.com/spanId": "000000000000004a",
 	}
 
 	require.True(t, reflect.DeepEqual(got, want), "unexpected output = %# v; \n want = %# v; \n diff: %# v", pretty.Formatter(got), pretty.Formatter(want), pretty.Diff(got, want))
@@ -52,7 +53,7 @@ func TestTraceWithProjectID(t *testing.T) {
 		WithProjectID("my-project"),
 	)
 
-	logger.WithField(KeyTrace, "my-trace").WithField(KeySpanID, "my-span").Info("my log entry")
+	logger.WithField(KeyTrace, "105445aa7843bc8bf206b12000100000").WithField(KeySpanID, "000000000000004a").Info("my log entry")
 
 	var got map[string]interface{}
 	json.Unmarshal(out.Bytes(), &got)
@@ -65,11 +66,73 @@ func TestTraceWithProjectID(t *testing.T) {
 			"service": "test",
 			"version": "0.1",
 		},
-		"trace_id":                      "my-trace",
-		"logging.googleapis.com/trace":  "projects/my-project/traces/my-trace",
-		"logging.googleapis.com/spanId": "my-span",
+		"trace_id":                      "105445aa7843bc8bf206b12000100000",
+		"logging.googleapis.com/trace":  "projects/my-project/traces/105445aa7843bc8bf206b12000100000",
+		"logging.googleapis.com/spanId": "000000000000004a",
 	}
 
 	require.True(t, reflect.DeepEqual(got, want), "unexpected output = %# v; \n want = %# v; \n diff: %# v", pretty.Formatter(got), pretty.Formatter(want), pretty.Diff(got, want))
 
 }
+
+type traceProjectContextKey struct{}
+
+func TestTraceProject(t *testing.T) {
+	const trace = "105445aa7843bc8bf206b12000100000"
+
+	ctx := context.WithValue(context.Background(), traceProjectContextKey{}, "context-project")
+
+	for _, tc := range []struct {
+		projectID string
+		entry     func(*logrus.Entry) *logrus.Entry
+		want      string
+	}{
+		{
+			projectID: "my-project",
+			entry: func(e *logrus.Entry) *logrus.Entry {
+				return e.WithField(KeyTrace, trace).WithField(KeyTraceProject, "caller-project")
+			},
+			want: "projects/caller-project/traces/" + trace,
+		},
+		{
+			projectID: "my-project",
+			entry: func(e *logrus.Entry) *logrus.Entry {
+				return e.WithContext(ctx).WithField(KeyTrace, trace)
+			},
+			want: "projects/context-project/traces/" + trace,
+		},
+		{
+			projectID: "my-project",
+			entry: func(e *logrus.Entry) *logrus.Entry {
+				return e.WithContext(ctx).WithField(KeyTrace, "projects/trace-project/traces/"+trace)
+			},
+			want: "projects/trace-project/traces/" + trace,
+		},
+		{
+			entry: func(e *logrus.Entry) *logrus.Entry {
+				return e.WithField(KeyTrace, trace).WithField(KeyTraceProject, "caller-project")
+			},
+			want: "projects/caller-project/traces/" + trace,
+		},
+	} {
+		var out bytes.Buffer
+
+		logger := logrus.New()
+		logger.Out = &out
+		logger.Formatter = NewFormatter(
+			WithProjectID(tc.projectID),
+			WithTraceProjectExtractor(func(ctx context.Context) string {
+				project, _ := ctx.Value(traceProjectContextKey{}).(string)
+				return project
+			}),
+		)
+
+		tc.entry(logrus.NewEntry(logger)).Info("my log entry")
+
+		var got map[string]interface{}
+		require.NoError(t, json.Unmarshal(out.Bytes(), &got))
+		require.Equal(t, tc.want, got["logging.googleapis.com/trace"])
+		require.Equal(t, trace, got["trace_id"])
+		require.Equal(t, map[string]interface{}{}, got["context"])
+	}
+}
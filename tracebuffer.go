@@ -0,0 +1,174 @@
+package stackdriver
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// TraceBuffer holds back the less severe entries of each trace, and writes
+// them only when an entry of the trace is as severe as the trigger level,
+// so the DEBUG entries of failing requests are kept while the others are
+// discarded. The logger has to let through the entries to buffer, e.g.
+// with logger.SetLevel(logrus.DebugLevel).
+//
+// Entries are buffered as they are formatted, and written with their
+// original timestamp. Once a trace is triggered its entries are written
+// right away. Call Discard when the request of a trace ends.
+type TraceBuffer struct {
+	level     logrus.Level
+	trigger   logrus.Level
+	size      int
+	maxTraces int
+
+	mu     sync.Mutex
+	traces map[string]*traceEntries
+	order  []string
+}
+
+type traceEntries struct {
+	entries   []Entry
+	next      int
+	triggered bool
+}
+
+// TraceBufferOption lets you configure the TraceBuffer.
+type TraceBufferOption func(*TraceBuffer)
+
+// WithTraceBufferLevel sets the least severe level written right away, less
+// severe entries are buffered. Defaults to logrus.InfoLevel.
+func WithTraceBufferLevel(l logrus.Level) TraceBufferOption {
+	return func(b *TraceBuffer) {
+		b.level = l
+	}
+}
+
+// WithTraceBufferTrigger sets the least severe level writing the buffered
+// entries of its trace. Defaults to logrus.ErrorLevel.
+func WithTraceBufferTrigger(l logrus.Level) TraceBufferOption {
+	return func(b *TraceBuffer) {
+		b.trigger = l
+	}
+}
+
+// WithTraceBufferSize sets how many entries are buffered per trace, the
+// oldest are discarded first. Defaults to 100.
+func WithTraceBufferSize(n int) TraceBufferOption {
+	return func(b *TraceBuffer) {
+		b.size = n
+	}
+}
+
+// WithTraceBufferTraces sets how many traces are buffered, the oldest are
+// discarded first. Defaults to 1000.
+func WithTraceBufferTraces(n int) TraceBufferOption {
+	return func(b *TraceBuffer) {
+		b.maxTraces = n
+	}
+}
+
+// NewTraceBuffer returns a new TraceBuffer.
+func NewTraceBuffer(options ...TraceBufferOption) *TraceBuffer {
+	b := &TraceBuffer{
+		level:     logrus.InfoLevel,
+		trigger:   logrus.ErrorLevel,
+		size:      100,
+		maxTraces: 1000,
+		traces:    map[string]*traceEntries{},
+	}
+	for _, option := range options {
+		option(b)
+	}
+	return b
+}
+
+// WithTraceBuffer lets you configure a TraceBuffer holding back entries
+// written by Format.
+func WithTraceBuffer(b *TraceBuffer) Option {
+	return func(f *Formatter) {
+		f.traceBuffer = b
+	}
+}
+
+// Discard forgets the entries of trace, with or without the project path.
+func (b *TraceBuffer) Discard(trace string) {
+	key := traceKey(trace)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, ok := b.traces[key]; !ok {
+		return
+	}
+	delete(b.traces, key)
+	for i, k := range b.order {
+		if k == key {
+			b.order = append(b.order[:i], b.order[i+1:]...)
+			break
+		}
+	}
+}
+
+// buffer reports whether ee, at level l, is written, and returns the
+// buffered entries to write before it.
+func (b *TraceBuffer) buffer(l logrus.Level, ee Entry) (bool, []Entry) {
+	if ee.Trace == "" {
+		return true, nil
+	}
+	key := traceKey(ee.Trace)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	t, ok := b.traces[key]
+	if !ok {
+		if l <= b.level {
+			return true, nil
+		}
+		t = b.add(key)
+	}
+
+	switch {
+	case t.triggered:
+		return true, nil
+	case l <= b.trigger:
+		t.triggered = true
+		entries := make([]Entry, 0, len(t.entries))
+		entries = append(entries, t.entries[t.next:]...)
+		entries = append(entries, t.entries[:t.next]...)
+		t.entries = nil
+		return true, entries
+	case l <= b.level:
+		return true, nil
+	}
+
+	if len(t.entries) < b.size {
+		t.entries = append(t.entries, ee)
+	} else if b.size > 0 {
+		t.entries[t.next] = ee
+		t.next = (t.next + 1) % b.size
+	}
+	return false, nil
+}
+
+// add starts buffering the entries of a trace, discarding the oldest trace
+// when there are too many. It must be called with b.mu held.
+func (b *TraceBuffer) add(key string) *traceEntries {
+	if len(b.order) >= b.maxTraces && len(b.order) > 0 {
+		delete(b.traces, b.order[0])
+		b.order = b.order[1:]
+	}
+	t := &traceEntries{}
+	b.traces[key] = t
+	b.order = append(b.order, key)
+	return t
+}
+
+// traceKey returns the trace ID of trace, without the project path.
+func traceKey(trace string) string {
+	if i := strings.LastIndex(trace, "/traces/"); i >= 0 {
+		return trace[i+len("/traces/"):]
+	}
+	return trace
+}
@@ -0,0 +1,78 @@
+package stackdriver
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+type traceContextKey struct{}
+
+func TestTraceBuffer(t *testing.T) {
+	var out bytes.Buffer
+
+	buffer := NewTraceBuffer(WithTraceBufferSize(2))
+
+	logger := logrus.New()
+	logger.Out = &out
+	logger.Level = logrus.DebugLevel
+	logger.Formatter = NewFormatter(
+		WithProjectID("my-project"),
+		WithTraceBuffer(buffer),
+		WithTraceExtractor(func(ctx context.Context) string {
+			trace, _ := ctx.Value(traceContextKey{}).(string)
+			return trace
+		}),
+	)
+
+	failing := logger.WithContext(context.WithValue(context.Background(), traceContextKey{}, "00000000000000000000000000000001"))
+	succeeding := logger.WithField(KeyTrace, "00000000000000000000000000000002")
+
+	failing.Debug("first")
+	succeeding.Debug("discarded")
+	failing.Debug("second")
+	failing.Info("written")
+	failing.Debug("third")
+	logger.Debug("untraced")
+
+	entries := decodeEntries(t, &out)
+	require.Len(t, entries, 2)
+	require.Equal(t, "written", entries[0]["message"])
+	require.Equal(t, "untraced", entries[1]["message"])
+
+	failing.Error("failed")
+	failing.Debug("after")
+	buffer.Discard("projects/my-project/traces/00000000000000000000000000000002")
+	succeeding.Error("failed")
+
+	var messages []interface{}
+	for _, entry := range decodeEntries(t, &out) {
+		messages = append(messages, entry["message"])
+	}
+	require.Equal(t, []interface{}{"second", "third", "failed", "after", "failed"}, messages)
+}
+
+func TestTraceBufferTimestamps(t *testing.T) {
+	skipTimestamp = false
+	defer func() { skipTimestamp = true }()
+
+	var out bytes.Buffer
+
+	logger := logrus.New()
+	logger.Out = &out
+	logger.Level = logrus.DebugLevel
+	logger.Formatter = NewFormatter(WithTraceBuffer(NewTraceBuffer()))
+
+	traced := logger.WithField(KeyTrace, "105445aa7843bc8bf206b12000100000")
+	traced.WithTime(time.Date(2020, 10, 12, 14, 26, 0, 0, time.UTC)).Debug("debug entry")
+	traced.Error("error entry")
+
+	entries := decodeEntries(t, &out)
+	require.Len(t, entries, 2)
+	require.Equal(t, "debug entry", entries[0]["message"])
+	require.Equal(t, "2020-10-12T14:26:00Z", entries[0]["timestamp"])
+}
@@ -0,0 +1,120 @@
+package stackdriver
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// keyFormatWarnings holds the problems found with the values of the known
+// keys, whose invalid values are left in the entry data.
+const keyFormatWarnings = "formatWarnings"
+
+// maxLogIDLength is the longest URL-encoded log ID Cloud Logging accepts.
+const maxLogIDLength = 512
+
+// WithStrictValidation makes Format fail for entries with an invalid trace,
+// span or log ID, rather than leaving the values in the entry data with a
+// warning.
+func WithStrictValidation() Option {
+	return func(f *Formatter) {
+		f.StrictValidation = true
+	}
+}
+
+// parseTrace returns the project and the ID of trace, lowercased and
+// without the projects/[PROJECT_ID]/traces/ prefixes, repeated or not.
+func parseTrace(trace string) (project, id string, err error) {
+	id = trace
+	for strings.HasPrefix(id, "projects/") {
+		parts := strings.SplitN(id, "/", 4)
+		if len(parts) != 4 || parts[2] != "traces" || parts[1] == "" {
+			break
+		}
+		if project == "" {
+			project = parts[1]
+		}
+		id = parts[3]
+	}
+
+	id = strings.ToLower(id)
+	if !isHexID(id, traceIDSize) {
+		return "", "", fmt.Errorf("invalid trace %q: want 32 hex digits", trace)
+	}
+	return project, id, nil
+}
+
+// parseSpanID returns span lowercased. Decimal span IDs, as found in the
+// X-Cloud-Trace-Context header, are converted to hex.
+func parseSpanID(span string) (string, error) {
+	id := strings.ToLower(span)
+	if len(id) != 2*spanIDSize {
+		if u, err := strconv.ParseUint(id, 10, 64); err == nil {
+			id = fmt.Sprintf("%016x", u)
+		}
+	}
+	if !isHexID(id, spanIDSize) {
+		return "", fmt.Errorf("invalid span ID %q: want 16 hex digits", span)
+	}
+	return id, nil
+}
+
+// logNameParents are the resources a qualified log name can belong to.
+var logNameParents = []string{"projects/", "folders/", "organizations/", "billingAccounts/"}
+
+// parseLogName returns the parent of name, when it is a qualified log name
+// like projects/[PROJECT_ID]/logs/[LOG_ID], and its URL-encoded log ID.
+func parseLogName(name string) (parent, id string, err error) {
+	id = name
+	for _, prefix := range logNameParents {
+		if !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		parts := strings.SplitN(name, "/", 4)
+		if len(parts) == 4 && parts[1] != "" && parts[2] == "logs" {
+			parent, id = strings.Join(parts[:3], "/")+"/", parts[3]
+		}
+		break
+	}
+
+	id = escapeLogID(id)
+	if id == "" || len(id) > maxLogIDLength {
+		return "", "", fmt.Errorf("invalid log ID %q: want 1 to %d URL-encoded characters", name, maxLogIDLength)
+	}
+	return parent, id, nil
+}
+
+// escapeLogID URL-encodes id, unless it already is.
+func escapeLogID(id string) string {
+	if unescaped, err := url.PathUnescape(id); err == nil {
+		id = unescaped
+	}
+	return url.PathEscape(id)
+}
+
+// isHexID reports whether id is the lowercase hex encoding of a non-zero
+// identifier of size bytes.
+func isHexID(id string, size int) bool {
+	if len(id) != 2*size || strings.Trim(id, "0") == "" || strings.ToLower(id) != id {
+		return false
+	}
+	_, err := hex.DecodeString(id)
+	return err == nil
+}
+
+// invalidValues records the warnings about invalid values in the entry
+// data, and returns them as an error for strict validation.
+func invalidValues(ee *Entry, warnings []error) error {
+	if len(warnings) == 0 {
+		return nil
+	}
+	messages := make([]string, len(warnings))
+	for i, err := range warnings {
+		messages[i] = err.Error()
+	}
+	ee.Context.Data[keyFormatWarnings] = messages
+	return errors.Join(warnings...)
+}
@@ -0,0 +1,83 @@
+package stackdriver
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidation(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		fields logrus.Fields
+		want   map[string]interface{}
+	}{
+		{
+			name: "normalised",
+			fields: logrus.Fields{
+				KeyTrace:  "projects/my-project/traces/projects/my-project/traces/105445AA7843BC8BF206B12000100000",
+				KeySpanID: "74",
+				KeyLogID:  "cloudresourcemanager.googleapis.com/activity",
+			},
+			want: map[string]interface{}{
+				"logging.googleapis.com/trace":  "projects/my-project/traces/105445aa7843bc8bf206b12000100000",
+				"trace_id":                      "105445aa7843bc8bf206b12000100000",
+				"logging.googleapis.com/spanId": "000000000000004a",
+				"logName":                       "projects/my-project/logs/cloudresourcemanager.googleapis.com%2Factivity",
+				"context":                       map[string]interface{}{},
+			},
+		},
+		{
+			name: "invalid",
+			fields: logrus.Fields{
+				KeyTrace:  "not-a-trace",
+				KeySpanID: "00000000000000000",
+				KeyLogID:  "",
+			},
+			want: map[string]interface{}{
+				"context": map[string]interface{}{
+					"data": map[string]interface{}{
+						KeyTrace:  "not-a-trace",
+						KeySpanID: "00000000000000000",
+						KeyLogID:  "",
+						"formatWarnings": []interface{}{
+							`invalid trace "not-a-trace": want 32 hex digits`,
+							`invalid span ID "00000000000000000": want 16 hex digits`,
+							`invalid log ID "": want 1 to 512 URL-encoded characters`,
+						},
+					},
+				},
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var out bytes.Buffer
+
+			logger := logrus.New()
+			logger.Out = &out
+			logger.Formatter = NewFormatter(WithProjectID("my-project"))
+
+			logger.WithFields(tc.fields).Info("my log entry")
+
+			var got map[string]interface{}
+			require.NoError(t, json.Unmarshal(out.Bytes(), &got))
+			delete(got, "severity")
+			delete(got, "message")
+			delete(got, "serviceContext")
+			require.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestStrictValidation(t *testing.T) {
+	f := NewFormatter(WithStrictValidation())
+
+	_, err := f.Format(logrus.WithField(KeyTrace, "not-a-trace"))
+	require.EqualError(t, err, `invalid trace "not-a-trace": want 32 hex digits`)
+
+	_, err = f.Format(logrus.WithField(KeyTrace, "105445aa7843bc8bf206b12000100000"))
+	require.NoError(t, err)
+}